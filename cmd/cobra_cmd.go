@@ -5,53 +5,182 @@ import (
 	"github.com/startswithzed/blitz/core"
 	"github.com/startswithzed/blitz/tui"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
-var config core.Config
+// the CLI logs what the runner does to stderr
+var config = core.Config{Logger: log.Default()}
 var rootCmd *cobra.Command
 
+// protocol flags, folded into config.Protocol
+var http2Only, h2c, http1Only bool
+
+// modes that don't run a load test
+var dryRun, once bool
+
 func createRootCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "blitz --req-spec /path/to/spec.json",
 		Short: "Load test your web server 🌐💪",
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// flags were fine, so errors from here on aren't usage errors
+			cmd.SilenceUsage = true
+			applyProtocol()
+
+			switch {
+			case dryRun:
+				return runDryRun()
+			case once:
+				return runDebug()
+			}
+
 			ticker := time.NewTicker(time.Second)
 
-			runner := core.NewRunner(config, ticker)
-			runner.LoadTest()
+			runner := core.NewRunner(config, time.NewTicker(time.Second))
+			if err := runner.LoadTest(); err != nil {
+				ticker.Stop()
+				return runError{err}
+			}
+
+			// stop the test on SIGINT/SIGTERM instead of getting killed mid-run.
+			// Signals are handled until the command returns, as the dashboard
+			// stays open once the test is over and has to be closed as well.
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+			defer signal.Stop(sigs)
+
+			stop := make(chan struct{})
+			closed := make(chan struct{}) // the dashboard gave the terminal back
+			finished := make(chan struct{})
+			defer close(finished)
+			go func() {
+				select {
+				case <-sigs:
+					runner.Cancel()
+					close(stop)
+				case <-closed:
+				case <-finished:
+					return
+				}
+
+				// a signal during the grace period exits without waiting for the
+				// in-flight requests or printing the summary, once the terminal
+				// is restored
+				select {
+				case <-closed:
+				case <-finished:
+					return
+				}
+				select {
+				case <-sigs:
+					log.Println("exiting without waiting for in-flight requests 🛑")
+					os.Exit(exitInterrupted)
+				case <-finished:
+				}
+			}()
 
 			dc := tui.DashboardConfig{
 				Duration:    config.Duration,
+				Warmup:      config.Warmup,
 				Ticker:      ticker,
 				Cancel:      runner.Cancel,
-				ReqPS:       runner.ReqPS,
-				ResPS:       runner.ResPS,
-				ResTimes:    runner.ResTimesOut,
-				ResStats:    runner.ResStats,
+				Stop:        stop,
+				Control:     runner,
+				Snapshots:   runner.Snapshots,
 				ErrorStream: runner.ErrOut,
-				ErrorCount:  runner.ErrCountChan,
 			}
 
 			dashboard := tui.NewDashboard(dc)
-			dashboard.DrawDashboard()
 			defer close(dashboard.RefreshReqChan)
+			err := dashboard.DrawDashboard()
+			close(closed)
+			if err != nil {
+				runner.Cancel()
+				<-runner.Done
+				return runError{dashboardError{err}}
+			}
 
 			log.Println("shutting down load test 🛑")
+			runner.Cancel()
+
+			// in-flight requests get up to the grace period to finish
+			<-runner.Done
 
-			<-runner.Done // wait for the done channel to close before exiting the program
+			printSummary(runner.Summary())
+			return nil
 		},
 	}
+	cmd.SilenceErrors = true
 
-	cmd.Flags().StringVarP(&config.ReqSpecPath, "req-spec", "r", "", "Path to the request specification json file 📄")
 	cmd.Flags().DurationVarP(&config.Duration, "duration", "d", time.Minute, "Duration of the test in minutes ⏰")
+	cmd.Flags().DurationVarP(&config.Warmup, "warmup", "w", 0, "Warm-up period before the test whose samples are left out of the stats 🔥")
+	cmd.Flags().DurationVarP(&config.Grace, "grace", "g", 10*time.Second, "Time to wait for in-flight requests to finish on shutdown ⌛")
 	cmd.Flags().IntVarP(&config.NumClients, "num-clients", "c", 1, "Number of concurrent clients sending requests to the server 🚀")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print every request as it would be sent, without sending anything 📝")
+	cmd.Flags().BoolVar(&once, "once", false, "Send every request once and print what came back instead of load testing, like blitz debug 🐞")
+	cmd.MarkFlagsMutuallyExclusive("dry-run", "once")
+	addRequestFlags(cmd)
 
-	cmd.MarkFlagRequired("req-spec")
+	cmd.AddCommand(createValidateCmd())
+	cmd.AddCommand(createDebugCmd())
 
 	return cmd
 }
 
+// addRequestFlags adds the flags that shape how requests are sent, shared by
+// the load test and blitz debug
+func addRequestFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&config.ReqSpecPath, "req-spec", "r", "", "Path to the request specification json file 📄")
+	cmd.Flags().DurationVarP(&config.Timeout, "timeout", "t", 30*time.Second, "Time to wait for a response before giving up on a request, 0 to wait forever ⏱️")
+
+	cmd.Flags().StringVar(&config.TLS.CACert, "cacert", "", "PEM bundle of CA certificates to verify servers with instead of the system ones 🔏")
+	cmd.Flags().StringVar(&config.TLS.Cert, "cert", "", "PEM client certificate for mutual TLS 🪪")
+	cmd.Flags().StringVar(&config.TLS.Key, "key", "", "PEM key of the client certificate, if not in the --cert file 🔑")
+	cmd.Flags().BoolVarP(&config.TLS.Insecure, "insecure", "k", false, "Skip verifying server certificates ⚠️")
+	cmd.Flags().StringVar(&config.TLS.ServerName, "server-name", "", "Server name sent with SNI and used to verify the certificate 🏷️")
+	cmd.Flags().StringVar(&config.TLS.MinVersion, "tls-min", "", "Lowest TLS version to use: 1.0, 1.1, 1.2 or 1.3 🔽")
+	cmd.Flags().StringVar(&config.TLS.MaxVersion, "tls-max", "", "Highest TLS version to use: 1.0, 1.1, 1.2 or 1.3 🔼")
+	cmd.Flags().StringSliceVar(&config.TLS.Ciphers, "ciphers", nil, "Comma separated cipher suites to offer, in order of preference (TLS 1.2 and below) 🧮")
+
+	cmd.Flags().BoolVar(&http2Only, "http2", false, "Only speak HTTP/2, negotiated with ALPN over TLS ⚡")
+	cmd.Flags().BoolVar(&h2c, "h2c", false, "Speak cleartext HTTP/2 with prior knowledge to http:// URLs 📨")
+	cmd.Flags().BoolVar(&http1Only, "http1-only", false, "Only speak HTTP/1.1, even if the server offers HTTP/2 🐢")
+	cmd.MarkFlagsMutuallyExclusive("http2", "h2c", "http1-only")
+	cmd.Flags().StringVarP(&config.Proxy, "proxy", "x", "", "Send requests through an http://, https:// or socks5:// proxy instead of the one in HTTP_PROXY/HTTPS_PROXY 🧦")
+
+	cmd.Flags().StringArrayVar(&config.Resolve, "resolve", nil, "Connect to addr instead of resolving host:port, as host:port:addr. Can be repeated 🧭")
+	cmd.Flags().StringVar(&config.UnixSocket, "unix-socket", "", "Send every request over this unix socket instead of TCP 🔌")
+	cmd.Flags().BoolVar(&config.DNSCache, "dns-cache", false, "Resolve every host once and reuse the answer for the whole test 🗂️")
+
+	cmd.MarkFlagRequired("req-spec")
+}
+
+// applyProtocol folds the protocol flags into config
+func applyProtocol() {
+	switch {
+	case http2Only:
+		config.Protocol = core.ProtocolHTTP2
+	case h2c:
+		config.Protocol = core.ProtocolH2C
+	case http1Only:
+		config.Protocol = core.ProtocolHTTP1
+	}
+}
+
+// Execute runs the blitz command, printing any error it fails with, and
+// returns the exit code of the process
+func Execute() int {
+	err := GetRootCmd().Execute()
+	if err == nil {
+		return exitOK
+	}
+	printError(err)
+	return exitCode(err)
+}
+
 func GetRootCmd() *cobra.Command {
 	if rootCmd == nil {
 		rootCmd = createRootCmd()
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/startswithzed/blitz/core"
+	"sort"
+	"strings"
+	"time"
+)
+
+// failedRequestsError is a debug run in which some requests got no
+// response or one that would count as an error
+type failedRequestsError struct {
+	failed, total int
+}
+
+func (e failedRequestsError) Error() string {
+	return fmt.Sprintf("%d of %d requests failed", e.failed, e.total)
+}
+
+func createDebugCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "debug --req-spec /path/to/spec.json",
+		Short: "Send every request once and print what came back 🐞",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			applyProtocol()
+			return runDebug()
+		},
+	}
+	addRequestFlags(cmd)
+	return cmd
+}
+
+// runDryRun prints every request of the spec as it would be sent
+func runDryRun() error {
+	runner := core.NewRunner(config, time.NewTicker(time.Second))
+	requests, err := runner.DryRun()
+	if err != nil {
+		return runError{err}
+	}
+
+	for _, r := range requests {
+		fmt.Printf("request %d 📝\n", r.Index)
+		fmt.Println(indent(r.Text))
+		fmt.Println()
+	}
+	fmt.Printf("%d requests would be sent ✅\n", len(requests))
+	return nil
+}
+
+// runDebug sends every request of the spec once and prints the exchanges
+func runDebug() error {
+	runner := core.NewRunner(config, time.NewTicker(time.Second))
+
+	var failed, total int
+	err := runner.Debug(context.Background(), func(ex core.Exchange) {
+		total++
+		if ex.Err != nil || ex.Failed {
+			failed++
+		}
+		printExchange(ex)
+	})
+	if err != nil {
+		return runError{err}
+	}
+	if failed > 0 {
+		return runError{failedRequestsError{failed, total}}
+	}
+
+	fmt.Printf("all %d requests succeeded ✅\n", total)
+	return nil
+}
+
+func printExchange(ex core.Exchange) {
+	fmt.Printf("request %d 🐞\n", ex.Index)
+	fmt.Println(indent(ex.Text))
+
+	fmt.Println()
+	if ex.Err != nil {
+		fmt.Printf("  ❌ %v\n", ex.Err)
+	} else {
+		mark := "✅"
+		if ex.Failed {
+			mark = "❌"
+		}
+		fmt.Printf("  %s %s\n", mark, statusLine(ex))
+	}
+
+	names := make([]string, 0, len(ex.Headers))
+	for k := range ex.Headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		for _, v := range ex.Headers[k] {
+			fmt.Printf("  %s: %s\n", k, v)
+		}
+	}
+
+	fmt.Printf("  timing: %s\n", formatTiming(ex.Timing))
+
+	if ex.Body != "" {
+		fmt.Println()
+		fmt.Println(indent(ex.Body))
+	}
+	fmt.Println()
+}
+
+// statusLine names the protocol and status of a response, e.g. HTTP/1.1 200 OK
+func statusLine(ex core.Exchange) string {
+	parts := []string{ex.Proto}
+	if ex.Status != 0 {
+		parts = append(parts, fmt.Sprint(ex.Status))
+	}
+	if ex.StatusText != "" {
+		parts = append(parts, ex.StatusText)
+	} else if !ex.Failed {
+		parts = append(parts, "OK")
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatTiming lists the phases a request went through, e.g. connect 1ms
+func formatTiming(t core.Timing) string {
+	phases := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"dns", t.DNS},
+		{"connect", t.Connect},
+		{"tls", t.TLS},
+		{"first byte", t.FirstByte},
+		{"total", t.Total},
+	}
+
+	var parts []string
+	for _, p := range phases {
+		if p.d > 0 {
+			parts = append(parts, fmt.Sprintf("%s %v", p.name, p.d.Round(10*time.Microsecond)))
+		}
+	}
+	return strings.Join(parts, "  ")
+}
+
+// indent indents every line of s by two spaces
+func indent(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = "  " + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/startswithzed/blitz/core"
+	"os"
+	"sort"
+)
+
+// exit codes of the blitz command
+const (
+	exitOK              = 0
+	exitError           = 1 // any other failure, e.g. a bad TLS option
+	exitUsage           = 2 // bad flags or arguments
+	exitSpecNotFound    = 3
+	exitSpecParse       = 4
+	exitNoValidRequests = 5
+	exitDashboard       = 6
+	exitInvalidSpec     = 7   // blitz validate found problems
+	exitRequestsFailed  = 8   // blitz debug got errors back
+	exitInterrupted     = 130 // signalled during the grace period
+)
+
+// runError marks errors that came up running the command rather than
+// parsing its flags
+type runError struct {
+	err error
+}
+
+func (e runError) Error() string { return e.err.Error() }
+func (e runError) Unwrap() error { return e.err }
+
+// dashboardError is a dashboard that couldn't be drawn
+type dashboardError struct {
+	err error
+}
+
+func (e dashboardError) Error() string { return e.err.Error() }
+func (e dashboardError) Unwrap() error { return e.err }
+
+func exitCode(err error) int {
+	var run runError
+	var notFound *core.SpecNotFoundError
+	var parse *core.SpecParseError
+	var noValid *core.NoValidRequestsError
+	var dashboard dashboardError
+	var invalid invalidSpecError
+	var failed failedRequestsError
+
+	switch {
+	case !errors.As(err, &run):
+		return exitUsage
+	case errors.As(err, &notFound):
+		return exitSpecNotFound
+	case errors.As(err, &parse):
+		return exitSpecParse
+	case errors.As(err, &noValid):
+		return exitNoValidRequests
+	case errors.As(err, &dashboard):
+		return exitDashboard
+	case errors.As(err, &invalid):
+		return exitInvalidSpec
+	case errors.As(err, &failed):
+		return exitRequestsFailed
+	default:
+		return exitError
+	}
+}
+
+func printError(err error) {
+	fmt.Fprintf(os.Stderr, "blitz: %v ❌\n", err)
+
+	var notFound *core.SpecNotFoundError
+	var noValid *core.NoValidRequestsError
+	switch {
+	case errors.As(err, &notFound):
+		fmt.Fprintln(os.Stderr, "check the path given to --req-spec or validate")
+	case errors.As(err, &noValid):
+		invalid := append([]*core.InvalidRequestError(nil), noValid.Invalid...)
+		sort.Slice(invalid, func(i, j int) bool { return invalid[i].Index < invalid[j].Index })
+		for _, e := range invalid {
+			fmt.Fprintf(os.Stderr, "  %v\n", e)
+		}
+	}
+}
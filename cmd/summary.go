@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/startswithzed/blitz/core"
+	"time"
+)
+
+// formatBytes writes a byte count with a binary unit, e.g. 1.5 KiB
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+func printSummary(s core.Summary) {
+	var rps, sentPS, receivedPS float64
+	if s.Duration > 0 {
+		rps = float64(s.Responses) / s.Duration.Seconds()
+		sentPS = float64(s.BytesSent) / s.Duration.Seconds()
+		receivedPS = float64(s.BytesReceived) / s.Duration.Seconds()
+	}
+
+	fmt.Println("summary 📊")
+	fmt.Printf("  duration:               %v\n", s.Duration.Round(time.Millisecond))
+	fmt.Printf("  requests sent:          %d\n", s.Requests)
+	fmt.Printf("  responses received:     %d\n", s.Responses)
+	fmt.Printf("  errors:                 %d\n", s.Errors)
+	if s.Timeouts > 0 {
+		fmt.Printf("    %-20s  %d\n", "timeouts:", s.Timeouts)
+	}
+	for i, n := range s.NetworkErrors {
+		if n > 0 {
+			fmt.Printf("    %-20s  %d\n", core.ErrorCategory(i).String()+":", n)
+		}
+	}
+	if len(s.StatusCodes) > 0 {
+		fmt.Println("  status codes:")
+		for _, st := range s.StatusCodes {
+			fmt.Printf("    %-20s  %d\n", st.Status+":", st.Count)
+		}
+	}
+	fmt.Printf("  responses per second:   %.2f\n", rps)
+	if s.Responses > 0 {
+		fmt.Printf("  average response time:  %d ms\n", s.ResponseTimes.AverageTime)
+		fmt.Printf("  max response time:      %d ms\n", s.ResponseTimes.MaxTime)
+		fmt.Printf("  min response time:      %d ms\n", s.ResponseTimes.MinTime)
+	}
+	fmt.Printf("  bytes sent:             %s (%s/s)\n", formatBytes(float64(s.BytesSent)), formatBytes(sentPS))
+	fmt.Printf("  bytes received:         %s (%s/s)\n", formatBytes(float64(s.BytesReceived)), formatBytes(receivedPS))
+
+	if len(s.Protocols) > 0 {
+		fmt.Println("  per protocol (avg / p50 / p90 / p99 response time):")
+		for _, p := range s.Protocols {
+			fmt.Printf("    %-9s  %d responses  %d / %d / %d / %d ms  %s received\n", p.Protocol, p.Responses,
+				p.ResponseTimes.AverageTime, p.P50, p.P90, p.P99, formatBytes(float64(p.BytesReceived)))
+		}
+	}
+
+	if ws := s.WebSocket; ws.Connections > 0 || ws.Dropped > 0 {
+		var msgPS float64
+		if s.Duration > 0 {
+			msgPS = float64(ws.MessagesSent+ws.MessagesReceived) / s.Duration.Seconds()
+		}
+		fmt.Println("  websocket:")
+		fmt.Printf("    connections:          %d (%d dropped)\n", ws.Connections, ws.Dropped)
+		fmt.Printf("    connect time:         %d / %d / %d / %d ms (avg / p50 / p99 / max)\n",
+			ws.ConnectTimes.AverageTime, ws.ConnectP50, ws.ConnectP99, ws.ConnectTimes.MaxTime)
+		fmt.Printf("    messages:             %d sent, %d received (%.2f per second)\n", ws.MessagesSent, ws.MessagesReceived, msgPS)
+	}
+
+	if st := s.Streams; st.Streams > 0 {
+		var eventPS float64
+		if s.Duration > 0 {
+			eventPS = float64(st.Events) / s.Duration.Seconds()
+		}
+		fmt.Println("  streams:")
+		fmt.Printf("    streams:              %d (%d dropped)\n", st.Streams, st.Dropped)
+		fmt.Printf("    events:               %d (%.2f per second)\n", st.Events, eventPS)
+		fmt.Printf("    first event:          %d / %d / %d / %d ms (avg / p50 / p99 / max)\n",
+			st.FirstEvent.AverageTime, st.FirstP50, st.FirstP99, st.FirstEvent.MaxTime)
+		fmt.Printf("    event gap:            %d / %d / %d / %d ms (avg / p50 / p99 / max)\n",
+			st.EventGaps.AverageTime, st.EventGapP50, st.EventGapP99, st.EventGaps.MaxTime)
+	}
+
+	if len(s.Operations) > 0 {
+		fmt.Println("  per GraphQL operation (avg / p50 / p90 / p99 response time):")
+		for _, o := range s.Operations {
+			fmt.Printf("    %s  %d requests  %d errors  %d / %d / %d / %d ms\n", o.Name, o.Requests, o.Errors,
+				o.ResponseTimes.AverageTime, o.P50, o.P90, o.P99)
+		}
+	}
+
+	if len(s.Endpoints) > 0 {
+		fmt.Println("  per endpoint (avg sent / avg received):")
+		for _, e := range s.Endpoints {
+			fmt.Printf("    %-6s %s  %d requests  %s / %s\n", e.Verb, e.URL, e.Requests,
+				formatBytes(float64(e.AverageSent())), formatBytes(float64(e.AverageReceived())))
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/startswithzed/blitz/core"
+)
+
+// invalidSpecError is a spec that validate found problems in
+type invalidSpecError struct {
+	problems []*core.InvalidRequestError
+}
+
+func (e invalidSpecError) Error() string {
+	if len(e.problems) == 1 {
+		return "found 1 problem in the request spec"
+	}
+	return fmt.Sprintf("found %d problems in the request spec", len(e.problems))
+}
+
+func createValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate /path/to/spec.json",
+		Short: "Check a request spec without sending any request 🔍",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			problems, err := core.ValidateSpec(args[0])
+			if err != nil {
+				return runError{err}
+			}
+			if len(problems) > 0 {
+				for _, p := range problems {
+					fmt.Fprintf(cmd.OutOrStdout(), "%v\n", p)
+				}
+				return runError{invalidSpecError{problems}}
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%s is valid ✅\n", args[0])
+			return nil
+		},
+	}
+}
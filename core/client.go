@@ -1,10 +1,12 @@
 package core
 
 import (
-	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 )
@@ -14,132 +16,211 @@ type Request struct {
 	URL       string            `json:"url"`
 	Headers   map[string]string `json:"headers"`
 	Body      interface{}       `json:"body"`
-	BodyBytes []byte
+	Timeout   string            `json:"timeout"`  // e.g. "2s", overrides --timeout
+	Proxy     string            `json:"proxy"`    // overrides --proxy
+	Messages  []Message         `json:"messages"` // WebSocket script or gRPC stream
+	Stream    *Stream           `json:"stream"`   // read the response as a stream of events
+	Payload   *Payload          `json:"payload"`  // sent by tcp:// and udp:// requests
+	Reply     *Reply            `json:"reply"`    // expected by tcp:// and udp:// requests
+	BodyBytes []byte            `json:"-"`        // encoded by Prepare, not read from the spec
+
+	// GraphQL requests post Query with its Variables and OperationName
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+
+	// gRPC requests call Method on Target, resolved with the descriptors in
+	// Protoset or over server reflection, and send Body as the message
+	Target   string `json:"target"`
+	Method   string `json:"method"`
+	Protoset string `json:"protoset"`
+	TLS      bool   `json:"tls"`
+
+	index     int           // position in the validated spec
+	specIndex int           // position in the spec as written
+	target    string        // URL actually requested, differs for unix sockets, host:port for raw requests
+	host      string        // Host header sent instead of the host of target, unless Headers has one
+	timeout   time.Duration // parsed Timeout
+	proxy     *url.URL      // parsed Proxy
+	ws        bool          // ws:// or wss:// URL
+	grpc      *grpcCall     // resolved gRPC method
+	raw       string        // tcp or udp for raw requests
+
+	executor  Executor // sends the request, picked by prepareExecutors
+	operation int      // GraphQL stats slot plus one, zero for other requests
 }
 
 type Response struct {
 	StatusCode   int
 	ResponseTime int64
 	Timestamp    int64
+	Body         string // only kept for error responses
+	Proto        string // negotiated protocol, e.g. HTTP/2.0
+
+	BytesSent     uint64 // request line, headers and body
+	BytesReceived uint64 // status line, headers and body
 }
 
+// maxErrorBodySize caps how much of an error response body is kept for the logs
+const maxErrorBodySize = 1024
+
 type client struct {
-	requests     []*Request
-	ctx          context.Context
-	wg           *sync.WaitGroup
-	reqCountChan chan<- struct{}
-	resCountChan chan<- struct{}
-	resTimes     chan<- uint64
-	errorStream  chan<- interface{}
+	requests    []*Request
+	ctx         context.Context
+	reqCtx      context.Context // aborts in-flight requests
+	timeout     time.Duration
+	transports  *transports // shared by all clients
+	wg          *sync.WaitGroup
+	ctl         *control
+	shard       *shard
+	rand        *rand.Rand
+	errorStream chan<- interface{}
 }
 
 func newClient(
 	reqs []*Request,
 	ctx context.Context,
+	reqCtx context.Context,
+	timeout time.Duration,
+	transports *transports,
 	wg *sync.WaitGroup,
-	reqCountChan chan struct{},
-	resCountChan chan struct{},
-	resTimes chan<- uint64,
+	ctl *control,
+	shard *shard,
 	errorStream chan<- interface{},
 ) *client {
 	return &client{
-		requests:     reqs,
-		ctx:          ctx,
-		wg:           wg,
-		reqCountChan: reqCountChan,
-		resCountChan: resCountChan,
-		resTimes:     resTimes,
-		errorStream:  errorStream,
+		requests:    reqs,
+		ctx:         ctx,
+		reqCtx:      reqCtx,
+		timeout:     timeout,
+		transports:  transports,
+		wg:          wg,
+		ctl:         ctl,
+		shard:       shard,
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		errorStream: errorStream,
 	}
 }
 
-func (c *client) sendRequest(request *Request) (Response, error) {
-	client := &http.Client{}
+// clone copies a request with everything preparing it changes, nil stays nil
+func (req *Request) clone() *Request {
+	if req == nil {
+		return nil
+	}
+	c := *req
+	if req.Headers != nil {
+		c.Headers = make(map[string]string, len(req.Headers))
+		for k, v := range req.Headers {
+			c.Headers[k] = v
+		}
+	}
+	c.Messages = append([]Message(nil), req.Messages...)
+	if req.Stream != nil {
+		s := *req.Stream
+		c.Stream = &s
+	}
+	return &c
+}
 
-	var req *http.Request
-	var resp *http.Response
-	var err error
-	var startTime time.Time
+// requestTimeout returns the timeout of a request, zero if there is none
+func (c *client) requestTimeout(request *Request) time.Duration {
+	return request.timeoutOr(c.timeout)
+}
 
-	switch request.Verb {
-	case "GET":
-		req, err = http.NewRequest(request.Verb, request.URL, nil)
-		for k, v := range request.Headers {
-			req.Header.Set(k, v)
-		}
-	case "POST":
-		req, err = http.NewRequest(request.Verb, request.URL, bytes.NewReader(request.BodyBytes))
-		for k, v := range request.Headers {
-			req.Header.Set(k, v)
-		}
-	case "PUT":
-		req, err = http.NewRequest(request.Verb, request.URL, bytes.NewReader(request.BodyBytes))
-		for k, v := range request.Headers {
-			req.Header.Set(k, v)
-		}
-	case "DELETE":
-		req, err = http.NewRequest(request.Verb, request.URL, nil)
-		for k, v := range request.Headers {
-			req.Header.Set(k, v)
-		}
+// timeoutOr returns the timeout of a request, fallback if it has none
+func (req *Request) timeoutOr(fallback time.Duration) time.Duration {
+	if req.timeout > 0 {
+		return req.timeout
+	}
+	return fallback
+}
+
+// countingWriter counts and drops whatever is written to it
+type countingWriter struct {
+	n uint64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += uint64(len(p))
+	return len(p), nil
+}
+
+// requestSize estimates the bytes put on the wire for an HTTP/1.1 request,
+// body included if it has one
+func requestSize(req *http.Request) uint64 {
+	w := &countingWriter{}
+	fmt.Fprintf(w, "%s %s HTTP/1.1\r\nHost: %s\r\n", req.Method, req.URL.RequestURI(), req.Host)
+	req.Header.Write(w)
+	fmt.Fprint(w, "\r\n")
+	if req.ContentLength > 0 {
+		w.n += uint64(req.ContentLength)
 	}
+	return w.n
+}
+
+// responseHeaderSize estimates the bytes of the status line and headers
+func responseHeaderSize(resp *http.Response) uint64 {
+	w := &countingWriter{}
+	fmt.Fprintf(w, "%s %s\r\n", resp.Proto, resp.Status)
+	resp.Header.Write(w)
+	fmt.Fprint(w, "\r\n")
+	return w.n
+}
 
-	if err != nil {
-		return Response{Timestamp: startTime.UnixNano()}, err
+// readErrorBody returns the start of an error response body, marking it if it was cut short
+func readErrorBody(body io.Reader) string {
+	b, _ := io.ReadAll(io.LimitReader(body, maxErrorBodySize+1))
+	if len(b) > maxErrorBodySize {
+		return string(b[:maxErrorBodySize]) + "… (truncated)"
 	}
+	return string(b)
+}
 
-	startTime = time.Now()
-	c.reqCountChan <- struct{}{}
-	resp, err = client.Do(req)
-	if err != nil {
-		return Response{Timestamp: startTime.UnixNano()}, err
+// reportError counts an error in the window of its request and passes its
+// details on to the dashboard unless it is too far behind to take them
+func (c *client) reportError(w *shardWindow, err interface{}) {
+	switch e := err.(type) {
+	case NetworkError:
+		w.recordNetworkError(e.Category)
+	case TimeoutError:
+		w.recordTimeout()
+	case DroppedConnectionError:
+		if e.Request != nil && e.Request.Stream != nil {
+			w.recordStreamDrop()
+		} else {
+			w.recordDrop()
+		}
+	default:
+		w.recordError()
 	}
 
-	responseTime := time.Since(startTime)
-	c.resCountChan <- struct{}{}
+	if c.shard.isWarmup(w) {
+		err = markWarmup(err)
+	}
 
-	return Response{
-		StatusCode:   resp.StatusCode,
-		ResponseTime: responseTime.Milliseconds(),
-		Timestamp:    startTime.UnixNano(),
-	}, nil
+	select {
+	case c.errorStream <- err:
+	default:
+	}
 }
 
 func (c *client) start() {
-	rand.Seed(time.Now().UnixNano())
 	c.wg.Add(1)
 
 	go func(ctx context.Context) {
 		defer c.wg.Done()
+		defer c.shard.retire()
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			default:
-				request := c.requests[rand.Intn(len(c.requests))]
-
-				resp, err := c.sendRequest(request)
-				if err != nil {
-					c.errorStream <- NetworkError{
-						Timestamp: resp.Timestamp,
-						Error:     err,
-					}
-					continue
-				}
-
-				if resp.StatusCode >= 300 || resp.StatusCode < 200 {
-					c.errorStream <- ResponseError{
-						Timestamp:  resp.Timestamp,
-						Verb:       request.Verb,
-						URL:        request.URL,
-						StatusCode: resp.StatusCode,
-					}
-					c.resTimes <- uint64(resp.ResponseTime)
-					continue
+				if !c.ctl.wait(ctx) {
+					return
 				}
 
-				c.resTimes <- uint64(resp.ResponseTime)
+				c.execute(c.requests[c.rand.Intn(len(c.requests))])
 			}
 		}
 	}(c.ctx)
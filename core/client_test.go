@@ -0,0 +1,62 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchExecutor answers every request at once and ends the test after
+// limit of them
+type benchExecutor struct {
+	sent   int64
+	limit  int64
+	cancel context.CancelFunc
+}
+
+func (e *benchExecutor) Prepare(req *Request) error {
+	return nil
+}
+
+func (e *benchExecutor) Execute(ctx context.Context, req *Request) Result {
+	if atomic.AddInt64(&e.sent, 1) == e.limit {
+		e.cancel()
+	}
+	return Result{Status: 200, Proto: "HTTP/1.1", Latency: time.Millisecond, BytesSent: 128, BytesReceived: 512}
+}
+
+func (e *benchExecutor) Close() error {
+	return nil
+}
+
+// BenchmarkClientLoop runs the send loop of every client against an
+// executor that answers at once, until each of them sent b.N requests on
+// average, so an op is one request from every client
+func BenchmarkClientLoop(b *testing.B) {
+	for _, clients := range benchClients {
+		b.Run(fmt.Sprintf("clients=%d", clients), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			e := &benchExecutor{limit: int64(b.N * clients), cancel: cancel}
+			reqs := []*Request{{Verb: "GET", URL: "http://localhost/", executor: e}}
+			ctl := newControl()
+			errorStream := make(chan interface{})
+			var wg sync.WaitGroup
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := time.Now()
+
+			for i := 0; i < clients; i++ {
+				s := newShard(time.Time{}, len(reqs), 0)
+				newClient(reqs, ctx, ctx, 0, nil, &wg, ctl, s, errorStream).start()
+			}
+			wg.Wait()
+			b.ReportMetric(float64(atomic.LoadInt64(&e.sent))/time.Since(start).Seconds(), "req/s")
+		})
+	}
+}
@@ -1,10 +1,23 @@
 package core
 
-import "time"
+import (
+	"log"
+	"time"
+)
 
 type Config struct {
 	ReqSpecPath     string
 	Duration        time.Duration
+	Warmup          time.Duration
+	Grace           time.Duration
+	Timeout         time.Duration // per request, zero waits forever
 	NumClients      int
 	MetricsEndpoint string
+	TLS             TLSConfig
+	Protocol        string      // one of the Protocol constants
+	Proxy           string      // http://, https:// or socks5:// URL, the environment if empty
+	Resolve         []string    // host:port:addr overrides
+	DNSCache        bool        // resolve every host only once
+	UnixSocket      string      // send every request over this unix socket
+	Logger          *log.Logger // progress and requests left out of the test, nothing is logged if nil
 }
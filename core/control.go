@@ -0,0 +1,200 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// control gates the clients so a running test can be paused and throttled
+type control struct {
+	mu       sync.Mutex
+	paused   bool
+	resumed  chan struct{} // closed while the test is not paused
+	rps      uint64        // 0 means unlimited
+	interval time.Duration
+	next     time.Time
+	changed  chan struct{} // closed when clients waiting for a slot must check again
+}
+
+func newControl() *control {
+	resumed := make(chan struct{})
+	close(resumed)
+
+	return &control{resumed: resumed, changed: make(chan struct{})}
+}
+
+// notify wakes the clients holding a send slot, as it may no longer be
+// theirs. Callers hold mu.
+func (c *control) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *control) pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.paused {
+		c.paused = true
+		c.resumed = make(chan struct{})
+		c.notify()
+	}
+}
+
+func (c *control) resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.paused {
+		c.paused = false
+		c.next = time.Now()
+		close(c.resumed)
+	}
+}
+
+func (c *control) isPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.paused
+}
+
+func (c *control) setRPS(rps uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rps = rps
+	c.interval = 0
+	if rps > 0 {
+		c.interval = time.Second / time.Duration(rps)
+	}
+	c.next = time.Now()
+	c.notify()
+}
+
+func (c *control) getRPS() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.rps
+}
+
+// wait blocks until a client is allowed to send its next request. It returns
+// false if the context is done first.
+func (c *control) wait(ctx context.Context) bool {
+	for {
+		c.mu.Lock()
+		resumed := c.resumed
+		c.mu.Unlock()
+
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return false
+		}
+
+		c.mu.Lock()
+		if c.paused {
+			// paused again before this client got its turn
+			c.mu.Unlock()
+			continue
+		}
+		if c.interval == 0 {
+			c.mu.Unlock()
+			return true
+		}
+
+		// hand out evenly spaced send slots shared by all the clients
+		now := time.Now()
+		slot := c.next
+		if slot.Before(now) {
+			slot = now
+		}
+		c.next = slot.Add(c.interval)
+		changed := c.changed
+		c.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(slot))
+		select {
+		case <-timer.C:
+			// the slot stands unless the test was paused meanwhile
+			c.mu.Lock()
+			paused := c.paused
+			c.mu.Unlock()
+			if !paused {
+				return true
+			}
+		case <-changed:
+			// paused or the rate changed, book a new slot
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+// Pause holds all clients before their next request until Resume is called
+func (r *Runner) Pause() {
+	r.ctl.pause()
+}
+
+// Resume lets paused clients continue sending requests
+func (r *Runner) Resume() {
+	r.ctl.resume()
+}
+
+// Paused reports whether the clients are currently paused
+func (r *Runner) Paused() bool {
+	return r.ctl.isPaused()
+}
+
+// SetTargetRPS caps the combined request rate of all clients. Zero removes the cap.
+func (r *Runner) SetTargetRPS(rps uint64) {
+	r.ctl.setRPS(rps)
+}
+
+// TargetRPS returns the current request rate cap, zero if there is none
+func (r *Runner) TargetRPS() uint64 {
+	return r.ctl.getRPS()
+}
+
+// AddClients starts n more concurrent clients
+func (r *Runner) AddClients(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return
+	}
+
+	for i := 0; i < n; i++ {
+		ctx, cancel := context.WithCancel(r.ctx)
+		shard := newShard(r.warmupEnd, len(r.requests), len(r.operations))
+		client := newClient(r.requests, ctx, r.reqCtx, r.config.Timeout, r.transports, r.clientWg, r.ctl, shard, r.ErrOut)
+		client.start()
+		r.clients = append(r.clients, cancel)
+		r.shards = append(r.shards, shard)
+	}
+}
+
+// RemoveClients stops up to n clients once their in-flight requests finish
+func (r *Runner) RemoveClients(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := 0; i < n && len(r.clients) > 0; i++ {
+		last := len(r.clients) - 1
+		r.clients[last]()
+		r.clients = r.clients[:last]
+	}
+}
+
+// NumClients returns the number of clients currently sending requests
+func (r *Runner) NumClients() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.clients)
+}
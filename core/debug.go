@@ -0,0 +1,444 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxDebugBody caps how much of a response body Debug keeps
+const maxDebugBody = 4096
+
+// RenderedRequest is a request of the spec as it is sent
+type RenderedRequest struct {
+	Index int    // position in the spec
+	Text  string // request line, headers and body, or messages and payload for other protocols
+}
+
+// Timing breaks down where the time of a request went. Phases that didn't
+// happen, such as connecting over a reused connection, are zero.
+type Timing struct {
+	DNS       time.Duration
+	Connect   time.Duration
+	TLS       time.Duration
+	FirstByte time.Duration // from the request being written to the first byte of the response
+	Total     time.Duration
+}
+
+// Exchange is a request sent by Debug and what came back
+type Exchange struct {
+	RenderedRequest
+	Status     int    // status code, e.g. 200 or a gRPC code
+	StatusText string // e.g. OK or NotFound
+	Failed     bool   // the response would count as an error in a load test
+	Proto      string
+	Headers    http.Header // response headers of HTTP and WebSocket requests
+	Timing     Timing
+	Body       string // start of the response body, or the replies of other protocols
+	Err        error  // set if no response came back
+}
+
+// DryRun prepares the requests like a load test would and returns them as
+// they would be sent, without sending anything. gRPC methods aren't looked
+// up, as that may need the server.
+func (r *Runner) DryRun() ([]RenderedRequest, error) {
+	r.ticker.Stop()
+	if err := r.prepare(false); err != nil {
+		return nil, err
+	}
+	defer r.transports.close()
+	defer r.closeExecutors()
+
+	rendered := make([]RenderedRequest, 0, len(r.requests))
+	for _, req := range r.requests {
+		rendered = append(rendered, RenderedRequest{Index: req.specIndex, Text: req.render()})
+	}
+	return rendered, nil
+}
+
+// Debug sends every request once, one after the other, and calls each with
+// the exchange before sending the next. Cancelling ctx aborts the request
+// in flight and skips the rest.
+func (r *Runner) Debug(ctx context.Context, each func(Exchange)) error {
+	r.ticker.Stop()
+	if err := r.prepare(true); err != nil {
+		return err
+	}
+	defer r.transports.close()
+	defer r.closeExecutors()
+
+	// a client of its own gives the requests their timeouts and transports
+	c := newClient(r.requests, ctx, ctx, r.config.Timeout, r.transports, &sync.WaitGroup{}, r.ctl,
+		newShard(time.Time{}, len(r.requests), len(r.operations)), nil)
+
+	for _, req := range r.requests {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		ex := Exchange{RenderedRequest: RenderedRequest{Index: req.specIndex, Text: req.render()}}
+		switch e := req.executor.(type) {
+		case *wsExecutor:
+			c.debugWebSocket(req, &ex)
+		case *grpcExecutor:
+			c.debugGRPC(req, &ex)
+		case *rawExecutor:
+			c.debugRaw(req, &ex)
+		case *httpExecutor:
+			c.debugHTTP(req, e.protocol, &ex)
+		case *streamExecutor:
+			c.debugHTTP(req, e.protocol, &ex)
+		default:
+			c.debugExecutor(req, &ex)
+		}
+		each(ex)
+	}
+	return nil
+}
+
+// render writes a request down the way it is sent
+func (req *Request) render() string {
+	var b strings.Builder
+	switch {
+	case req.raw != "":
+		fmt.Fprintf(&b, "%s %s\n\n%q\n", req.Verb, req.URL, req.BodyBytes)
+		if r := req.Reply; r != nil && r.Delimiter != "" {
+			fmt.Fprintf(&b, "\nwaits for a reply ending with %q\n", r.Delimiter)
+		} else if r != nil {
+			fmt.Fprintf(&b, "\nwaits for a reply of %d bytes\n", r.Length)
+		}
+		return b.String()
+	case req.Verb == "GRAPHQL":
+		fmt.Fprintf(&b, "POST %s\n", req.URL)
+	case isGRPC(req):
+		fmt.Fprintf(&b, "%s %s %s\n", req.Verb, req.Target, req.Method)
+	default:
+		fmt.Fprintf(&b, "%s %s\n", req.Verb, req.URL)
+	}
+
+	names := make([]string, 0, len(req.Headers))
+	for k := range req.Headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(&b, "%s: %s\n", http.CanonicalHeaderKey(k), req.Headers[k])
+	}
+
+	switch {
+	case len(req.Messages) > 0:
+		b.WriteString("\n")
+		for _, m := range req.Messages {
+			fmt.Fprintf(&b, "> %s", m.bytes)
+			if m.delay > 0 {
+				fmt.Fprintf(&b, "  (after %v)", m.delay)
+			}
+			if m.NoReply {
+				b.WriteString("  (no reply)")
+			}
+			b.WriteString("\n")
+		}
+	case req.Verb == "GET" || req.Verb == "DELETE" || req.ws:
+	case len(req.BodyBytes) > 0 && string(req.BodyBytes) != "null":
+		fmt.Fprintf(&b, "\n%s\n", req.BodyBytes)
+	}
+	return b.String()
+}
+
+// debugTimeout gives ctx the timeout of a request
+func (c *client) debugTimeout(request *Request) (context.Context, context.CancelFunc) {
+	if timeout := c.requestTimeout(request); timeout > 0 {
+		return context.WithTimeout(c.reqCtx, timeout)
+	}
+	return context.WithCancel(c.reqCtx)
+}
+
+// tracer times the phases of a request from its httptrace hooks, which can
+// be called from several goroutines when dialing
+type tracer struct {
+	mu                               sync.Mutex
+	timing                           Timing
+	dnsStart, connectStart, tlsStart time.Time
+	wrote                            time.Time
+}
+
+func (t *tracer) trace(ctx context.Context) context.Context {
+	at := func(start *time.Time) func() {
+		return func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if start.IsZero() {
+				*start = time.Now()
+			}
+		}
+	}
+	since := func(start *time.Time, d *time.Duration) func() {
+		return func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if !start.IsZero() && *d == 0 {
+				*d = time.Since(*start)
+			}
+		}
+	}
+
+	dnsStart, dnsDone := at(&t.dnsStart), since(&t.dnsStart, &t.timing.DNS)
+	connectStart, connectDone := at(&t.connectStart), since(&t.connectStart, &t.timing.Connect)
+	tlsStart, tlsDone := at(&t.tlsStart), since(&t.tlsStart, &t.timing.TLS)
+	wrote, firstByte := at(&t.wrote), since(&t.wrote, &t.timing.FirstByte)
+
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { dnsStart() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { dnsDone() },
+		ConnectStart:         func(string, string) { connectStart() },
+		ConnectDone:          func(string, string, error) { connectDone() },
+		TLSHandshakeStart:    tlsStart,
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { tlsDone() },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wrote() },
+		GotFirstResponseByte: firstByte,
+	})
+}
+
+// phases returns what was timed so far
+func (t *tracer) phases() Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timing
+}
+
+// debugHTTP sends an HTTP request, GraphQL and streams included, and keeps
+// the start of its body. Streams are read until enough of the body is kept,
+// the server ends them or they have been held for their duration. Like a load
+// test, responses that didn't come over the protocol asked for fail.
+func (c *client) debugHTTP(request *Request, protocol string, ex *Exchange) {
+	ctx, cancel := c.debugTimeout(request)
+	defer cancel()
+	if s := request.Stream; s != nil && s.duration > 0 {
+		var hold context.CancelFunc
+		ctx, hold = context.WithTimeout(ctx, s.duration)
+		defer hold()
+	}
+	if request.proxy != nil {
+		ctx = withProxy(ctx, request.proxy)
+	}
+	t := &tracer{}
+	ctx = t.trace(ctx)
+
+	req, err := newHTTPRequest(ctx, request)
+	if err != nil {
+		ex.Err = err
+		return
+	}
+
+	startTime := time.Now()
+	resp, err := c.transports.http.Do(req)
+	if err != nil {
+		ex.Err = err
+		ex.Timing = t.phases()
+		ex.Timing.Total = time.Since(startTime)
+		return
+	}
+	defer resp.Body.Close()
+
+	// GraphQL bodies are read whole, their errors can come after what is kept
+	var reader io.Reader = io.LimitReader(resp.Body, maxDebugBody+1)
+	if request.operation > 0 {
+		reader = resp.Body
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil && (request.Stream == nil || ctx.Err() == nil) {
+		ex.Err = err
+	}
+	ex.Timing = t.phases()
+	ex.Timing.Total = time.Since(startTime)
+
+	ex.Status = resp.StatusCode
+	ex.StatusText = http.StatusText(resp.StatusCode)
+	ex.Proto = resp.Proto
+	ex.Headers = resp.Header
+	ex.Failed = resp.StatusCode >= 300 || resp.StatusCode < 200
+	ex.Body = truncateDebugBody(body)
+	if err := checkResponseProto(protocol, resp); err != nil {
+		ex.Err = err
+	}
+
+	if !ex.Failed && request.operation > 0 {
+		if readGraphQLErrors(bytes.NewReader(body)) != "" {
+			ex.Failed = true
+			ex.StatusText = graphqlErrorStatus
+		}
+	}
+}
+
+// debugWebSocket plays the message script of a request and keeps the replies
+func (c *client) debugWebSocket(request *Request, ex *Exchange) {
+	timeout := c.requestTimeout(request)
+	ctx, cancel := c.debugTimeout(request)
+	defer cancel()
+	if request.proxy != nil {
+		ctx = withProxy(ctx, request.proxy)
+	}
+	t := &tracer{}
+	ctx = t.trace(ctx)
+
+	header := http.Header{}
+	for k, v := range request.Headers {
+		header.Set(k, v)
+	}
+
+	startTime := time.Now()
+	conn, resp, err := c.transports.ws.DialContext(ctx, request.URL, header)
+	defer func() {
+		ex.Timing = t.phases()
+		ex.Timing.Total = time.Since(startTime)
+	}()
+	if resp != nil {
+		ex.Status = resp.StatusCode
+		ex.StatusText = http.StatusText(resp.StatusCode)
+		ex.Proto = resp.Proto
+		ex.Headers = resp.Header
+	}
+	if err != nil {
+		if resp != nil {
+			ex.Failed = true
+			ex.Body = readErrorBody(resp.Body)
+			return
+		}
+		ex.Err = err
+		return
+	}
+	defer conn.Close()
+	ex.Proto = protocolNames[protoWebSocket]
+
+	var replies []byte
+	for _, m := range request.Messages {
+		if m.delay > 0 {
+			select {
+			case <-time.After(m.delay):
+			case <-ctx.Done():
+				ex.Err = ctx.Err()
+				return
+			}
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, m.bytes); err != nil {
+			ex.Err = err
+			break
+		}
+		if m.NoReply {
+			continue
+		}
+		if timeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+		_, reply, err := conn.ReadMessage()
+		if err != nil {
+			ex.Err = err
+			break
+		}
+		replies = append(replies, "< "...)
+		replies = append(replies, reply...)
+		replies = append(replies, '\n')
+	}
+	ex.Body = truncateDebugBody(replies)
+
+	closing := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	conn.WriteControl(websocket.CloseMessage, closing, time.Now().Add(time.Second))
+}
+
+// debugGRPC makes the call of a request and keeps its replies as JSON
+func (c *client) debugGRPC(request *Request, ex *Exchange) {
+	ctx, cancel := c.debugTimeout(request)
+	defer cancel()
+	for k, v := range request.Headers {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(k), v)
+	}
+
+	var replies []byte
+	startTime := time.Now()
+	_, err := request.grpc.invoke(ctx, request, func(out proto.Message) {
+		b, _ := protojson.Marshal(out)
+		replies = append(replies, b...)
+		replies = append(replies, '\n')
+	})
+	ex.Timing.Total = time.Since(startTime)
+	ex.Proto = protocolNames[protoGRPC]
+
+	st, isStatus := status.FromError(err)
+	if err != nil && !isStatus {
+		ex.Err = err
+		return
+	}
+	ex.Status = int(st.Code())
+	ex.StatusText = st.Code().String()
+	ex.Failed = st.Code() != codes.OK
+	if ex.Failed {
+		replies = append(replies, st.Message()...)
+	}
+	ex.Body = truncateDebugBody(replies)
+}
+
+// debugRaw sends the payload of a tcp:// or udp:// request and keeps the reply
+func (c *client) debugRaw(request *Request, ex *Exchange) {
+	ctx, cancel := c.debugTimeout(request)
+	defer cancel()
+
+	startTime := time.Now()
+	reply, err := c.transports.sendRaw(ctx, request)
+	ex.Timing.Total = time.Since(startTime)
+	ex.Proto = strings.ToUpper(request.raw)
+
+	switch {
+	case errors.Is(err, errUnexpectedReply):
+		ex.Failed = true
+		ex.StatusText = unexpectedReplyStatus
+	case err != nil:
+		ex.Err = err
+		return
+	}
+	if len(reply) > maxDebugBody {
+		ex.Body = fmt.Sprintf("%q… (truncated)", reply[:maxDebugBody])
+	} else if reply != nil {
+		ex.Body = fmt.Sprintf("%q", reply)
+	}
+}
+
+// debugExecutor sends a request with the executor registered for its scheme
+func (c *client) debugExecutor(request *Request, ex *Exchange) {
+	ctx, cancel := c.debugTimeout(request)
+	defer cancel()
+	if request.proxy != nil {
+		ctx = withProxy(ctx, request.proxy)
+	}
+
+	result := request.executor.Execute(ctx, request)
+	ex.Status = result.Status
+	ex.StatusText = result.StatusText
+	ex.Failed = result.Failed
+	ex.Proto = result.Proto
+	ex.Timing.Total = result.Latency
+	ex.Body = result.Body
+	ex.Err = result.Err
+}
+
+func truncateDebugBody(body []byte) string {
+	if len(body) > maxDebugBody {
+		return string(body[:maxDebugBody]) + "… (truncated)"
+	}
+	return string(body)
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unixHostPrefix names the made up hosts unix socket URLs are rewritten to
+const unixHostPrefix = "unix-socket-"
+
+// unixHost is the Host header of requests to unix socket URLs, unless the
+// spec sets one
+const unixHost = "localhost"
+
+// parseUnixURL splits a URL such as unix:///var/run/app.sock:/path into the
+// socket path and the HTTP path, which defaults to /. Socket paths may hold
+// colons too, so the split is made after the first prefix that is a socket
+// on this machine, or else at the last colon followed by a single slash,
+// so URLs in the query such as ?next=http://host don't split it.
+func parseUnixURL(raw string) (socket, path string, err error) {
+	rest := strings.TrimPrefix(raw, "unix://")
+	socket, path = rest, ""
+	split := -1
+	for i := 0; i < len(rest); i++ {
+		if rest[i] != ':' {
+			continue
+		}
+		if info, err := os.Stat(rest[:i]); err == nil && info.Mode()&fs.ModeSocket != 0 {
+			split = i
+			break
+		}
+		if after := rest[i+1:]; after == "" || strings.HasPrefix(after, "/") && !strings.HasPrefix(after, "//") {
+			split = i
+		}
+	}
+	if split >= 0 {
+		socket, path = rest[:split], rest[split+1:]
+	}
+
+	if socket == "" {
+		return "", "", fmt.Errorf("invalid unix socket URL %q: expected unix:///path/to.sock:/path", raw)
+	}
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "", "", fmt.Errorf("invalid unix socket URL %q: the HTTP path must start with /", raw)
+	}
+	return socket, path, nil
+}
+
+// dialer connects to the addresses given by --resolve overrides and unix
+// sockets, and can keep DNS answers for the whole test so lookups don't
+// skew response times
+type dialer struct {
+	net.Dialer
+
+	overrides map[string]string // host:port to ip:port
+	socket    string            // every connection goes to this unix socket
+	sockets   map[string]string // made up host:port to unix socket
+
+	cache bool
+	mu    sync.Mutex
+	hosts map[string][]string
+}
+
+func newDialer(config Config, sockets map[string]string) (*dialer, error) {
+	d := &dialer{
+		Dialer: net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+		overrides: make(map[string]string),
+		socket:    config.UnixSocket,
+		sockets:   sockets,
+		cache:     config.DNSCache,
+		hosts:     make(map[string][]string),
+	}
+
+	for _, r := range config.Resolve {
+		parts := strings.SplitN(r, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid --resolve %q: expected host:port:addr", r)
+		}
+		addr := strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+		if net.ParseIP(addr) == nil {
+			return nil, fmt.Errorf("invalid --resolve %q: %q is not an IP address", r, parts[2])
+		}
+		d.overrides[net.JoinHostPort(parts[0], parts[1])] = net.JoinHostPort(addr, parts[1])
+	}
+
+	return d, nil
+}
+
+// lookup resolves a host once and answers from the cache from then on.
+// Failed lookups aren't cached.
+func (d *dialer) lookup(ctx context.Context, host string) ([]string, error) {
+	d.mu.Lock()
+	addrs, ok := d.hosts[host]
+	d.mu.Unlock()
+	if ok {
+		return addrs, nil
+	}
+
+	addrs, err := d.Resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	d.hosts[host] = addrs
+	d.mu.Unlock()
+
+	return addrs, nil
+}
+
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.socket != "" && !strings.HasPrefix(network, "udp") {
+		return d.Dialer.DialContext(ctx, "unix", d.socket)
+	}
+	if socket, ok := d.sockets[addr]; ok {
+		return d.Dialer.DialContext(ctx, "unix", socket)
+	}
+	if target, ok := d.overrides[addr]; ok {
+		return d.Dialer.DialContext(ctx, network, target)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if !d.cache || err != nil || net.ParseIP(host) != nil {
+		return d.Dialer.DialContext(ctx, network, addr)
+	}
+
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	for _, a := range addrs {
+		conn, err = d.Dialer.DialContext(ctx, network, net.JoinHostPort(a, port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
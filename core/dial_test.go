@@ -0,0 +1,96 @@
+package core
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseUnixURL(t *testing.T) {
+	// a socket whose directory holds a colon followed by a slash
+	dir := filepath.Join(t.TempDir(), "a:")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(dir, "srv.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer l.Close()
+
+	tests := []struct {
+		name   string
+		url    string
+		socket string
+		path   string
+		err    bool
+	}{
+		{name: "no path", url: "unix:///run/app.sock", socket: "/run/app.sock", path: "/"},
+		{name: "path", url: "unix:///run/app.sock:/health", socket: "/run/app.sock", path: "/health"},
+		{name: "trailing colon", url: "unix:///run/app.sock:", socket: "/run/app.sock", path: "/"},
+		{name: "last colon and slash", url: "unix:///run/a:/app.sock:/health", socket: "/run/a:/app.sock", path: "/health"},
+		{name: "colon without slash", url: "unix:///run/a:b.sock", socket: "/run/a:b.sock", path: "/"},
+		{name: "url in the query", url: "unix:///run/app.sock:/login?next=http://host/", socket: "/run/app.sock", path: "/login?next=http://host/"},
+		{name: "existing socket", url: "unix://" + sock + ":/x:/y", socket: sock, path: "/x:/y"},
+		{name: "existing socket with url in the query", url: "unix://" + sock + ":/go?to=http://host", socket: sock, path: "/go?to=http://host"},
+		{name: "no socket", url: "unix://:/health", err: true},
+		{name: "empty", url: "unix://", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			socket, path, err := parseUnixURL(tt.url)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parseUnixURL(%q) = %q, %q, want an error", tt.url, socket, path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseUnixURL(%q): %v", tt.url, err)
+			}
+			if socket != tt.socket || path != tt.path {
+				t.Errorf("parseUnixURL(%q) = %q, %q, want %q, %q", tt.url, socket, path, tt.socket, tt.path)
+			}
+		})
+	}
+}
+
+func TestDialerResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		resolve string
+		host    string
+		target  string
+		err     bool
+	}{
+		{name: "ipv4", resolve: "example.com:443:127.0.0.1", host: "example.com:443", target: "127.0.0.1:443"},
+		{name: "ipv6", resolve: "example.com:443:::1", host: "example.com:443", target: "[::1]:443"},
+		{name: "bracketed ipv6", resolve: "example.com:8080:[::1]", host: "example.com:8080", target: "[::1]:8080"},
+		{name: "no addr", resolve: "example.com:443", err: true},
+		{name: "no host", resolve: ":443:127.0.0.1", err: true},
+		{name: "no port", resolve: "example.com::127.0.0.1", err: true},
+		{name: "host name as addr", resolve: "example.com:443:localhost", err: true},
+		{name: "empty addr", resolve: "example.com:443:", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newDialer(Config{Resolve: []string{tt.resolve}}, nil)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("newDialer(--resolve %q) = %v, want an error", tt.resolve, d.overrides)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newDialer(--resolve %q): %v", tt.resolve, err)
+			}
+			if got := d.overrides[tt.host]; got != tt.target || len(d.overrides) != 1 {
+				t.Errorf("newDialer(--resolve %q) overrides = %v, want %s to %s", tt.resolve, d.overrides, tt.host, tt.target)
+			}
+		})
+	}
+}
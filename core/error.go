@@ -1,13 +1,157 @@
 package core
 
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
 type ResponseError struct {
 	Timestamp  int64
 	Verb       string
 	URL        string
 	StatusCode int
+	Status     string // status name when it isn't an HTTP one, e.g. gRPC Unavailable
+	Request    *Request
+	Body       string // truncated response body
+	Warmup     bool
 }
 
 type NetworkError struct {
 	Timestamp int64
+	Verb      string
+	URL       string
+	Request   *Request
 	Error     error
+	Category  ErrorCategory
+	Warmup    bool
+}
+
+// TimeoutError is a request that got no complete response within its timeout
+type TimeoutError struct {
+	Timestamp int64
+	Verb      string
+	URL       string
+	Request   *Request
+	Timeout   time.Duration
+	Warmup    bool
+}
+
+// DroppedConnectionError is a WebSocket connection that broke before its
+// message script was done, or a stream that ended before it was held long
+// enough or sent the expected events
+type DroppedConnectionError struct {
+	Timestamp int64
+	Verb      string
+	URL       string
+	Request   *Request
+	Messages  int // messages sent or events received before the drop
+	Error     error
+	Warmup    bool
+}
+
+// ErrorCategory tells apart the causes of network errors, e.g. a server
+// refusing connections from the generator running out of file descriptors
+type ErrorCategory int
+
+const (
+	DNSError ErrorCategory = iota
+	ConnectionRefused
+	ConnectionReset
+	TLSError
+	ConnectTimeout
+	ReadTimeout
+	UnexpectedEOF
+	TooManyOpenFiles
+	OtherError
+
+	NumErrorCategories = int(OtherError) + 1
+)
+
+var errorCategoryNames = [NumErrorCategories]string{
+	"DNS failure",
+	"conn refused",
+	"conn reset",
+	"TLS handshake",
+	"connect timeout",
+	"read timeout",
+	"EOF",
+	"too many files",
+	"other",
+}
+
+func (c ErrorCategory) String() string {
+	if c < 0 || int(c) >= NumErrorCategories {
+		return errorCategoryNames[OtherError]
+	}
+	return errorCategoryNames[c]
+}
+
+// classifyError sorts a network error into a category. Checks run from the
+// most to the least specific cause, since a DNS lookup can time out and a
+// dial can fail for lack of file descriptors.
+func classifyError(err error) ErrorCategory {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+
+	switch {
+	case errors.Is(err, syscall.EMFILE), errors.Is(err, syscall.ENFILE):
+		return TooManyOpenFiles
+	case errors.As(err, &dnsErr):
+		return DNSError
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ConnectionReset
+	case errors.As(err, &recordErr), errors.As(err, &authorityErr),
+		errors.As(err, &hostnameErr), errors.As(err, &invalidErr), isTLSFailure(err):
+		return TLSError
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return ConnectTimeout
+		}
+		return ReadTimeout
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return UnexpectedEOF
+	default:
+		return OtherError
+	}
+}
+
+// isTLSFailure catches handshake alerts and timeouts, which have no
+// exported type
+func isTLSFailure(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "tls:") || strings.Contains(msg, "TLS handshake") || strings.Contains(msg, "x509:")
+}
+
+// markWarmup flags an error as having happened during the warm-up period
+func markWarmup(err interface{}) interface{} {
+	switch e := err.(type) {
+	case ResponseError:
+		e.Warmup = true
+		return e
+	case NetworkError:
+		e.Warmup = true
+		return e
+	case TimeoutError:
+		e.Warmup = true
+		return e
+	case DroppedConnectionError:
+		e.Warmup = true
+		return e
+	default:
+		return err
+	}
 }
@@ -0,0 +1,345 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Executor sends the requests of one protocol. The runner prepares every
+// request with the executor of its URL scheme before the test starts, calls
+// Execute from all clients at once during the test and closes the executor
+// once the test is over.
+type Executor interface {
+	// Prepare checks a request and encodes what Execute needs, such as
+	// BodyBytes. Requests it returns an error for are left out of the test.
+	Prepare(req *Request) error
+
+	// Execute sends a request and waits for its response. ctx is done when
+	// the request times out or has to be aborted at the end of the test.
+	Execute(ctx context.Context, req *Request) Result
+
+	// Close releases the connections of the executor
+	Close() error
+}
+
+// Result is the outcome of executing a request
+type Result struct {
+	Status        int           // status code of the response, e.g. 200
+	StatusText    string        // name of the status if it isn't an HTTP one
+	Failed        bool          // the response counts as an error
+	Latency       time.Duration // time until the response arrived, its headers for HTTP
+	Proto         string        // protocol the response came over, e.g. HTTP/2.0
+	BytesSent     uint64
+	BytesReceived uint64
+	Body          string // start of the body of failed responses, for the logs
+	Err           error  // set if no response came back
+}
+
+// ExecutorFactory builds the executor of a load test
+type ExecutorFactory func(config Config) (Executor, error)
+
+var (
+	factoriesMu sync.Mutex
+	factories   = make(map[string]ExecutorFactory)
+)
+
+// RegisterExecutor has requests to URLs with the given scheme, e.g. "redis"
+// for redis://host:port, sent by an executor built with factory. Registering
+// a scheme blitz sends itself replaces the built-in executor: http, https
+// and unix for HTTP, ws and wss, tcp and udp, or grpc for gRPC requests.
+func RegisterExecutor(scheme string, factory ExecutorFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[strings.ToLower(scheme)] = factory
+}
+
+func registeredExecutor(scheme string) ExecutorFactory {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	return factories[scheme]
+}
+
+// urlScheme returns the lowercased scheme of a URL, empty if it has none
+func urlScheme(url string) string {
+	scheme, _, ok := strings.Cut(url, "://")
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(scheme)
+}
+
+// requestScheme returns the scheme that picks the executor of a request,
+// grpc for gRPC requests
+func requestScheme(req *Request) string {
+	if isGRPC(req) {
+		return "grpc"
+	}
+	return urlScheme(req.URL)
+}
+
+// builtInKind names the built-in executor of a request, empty if blitz
+// can't send it itself
+func builtInKind(req *Request) string {
+	switch requestScheme(req) {
+	case "http", "https", "unix":
+		if req.Stream != nil {
+			return "stream"
+		}
+		return "http"
+	case "ws", "wss":
+		return "ws"
+	case "tcp", "udp":
+		return "raw"
+	case "grpc":
+		return "grpc"
+	}
+	return ""
+}
+
+// newBuiltInExecutor returns the built-in executor of a kind named by
+// builtInKind. Its requests can be prepared without transports.
+func newBuiltInExecutor(kind string, config Config, t *transports) Executor {
+	switch kind {
+	case "http":
+		return &httpExecutor{t: t, protocol: config.Protocol}
+	case "stream":
+		return &streamExecutor{t: t, protocol: config.Protocol, timeout: config.Timeout}
+	case "ws":
+		return &wsExecutor{t: t, timeout: config.Timeout}
+	case "raw":
+		return &rawExecutor{t: t}
+	case "grpc":
+		return &grpcExecutor{}
+	}
+	return nil
+}
+
+// prepareExecutors builds the executors of the requests in the spec and
+// prepares their requests, dropping those that can't be sent
+func (r *Runner) prepareExecutors() error {
+	builtIn := make(map[string]Executor)
+	byScheme := make(map[string]Executor)
+
+	prepared := make([]*Request, 0, len(r.requests))
+	for _, req := range r.requests {
+		scheme := requestScheme(req)
+		e, ok := byScheme[scheme]
+		if !ok {
+			if factory := registeredExecutor(scheme); factory != nil {
+				var err error
+				if e, err = factory(r.config); err != nil {
+					return fmt.Errorf("could not create the %s executor: %w", scheme, err)
+				}
+				r.executors = append(r.executors, e)
+				byScheme[scheme] = e
+			}
+		}
+		if e == nil {
+			kind := builtInKind(req)
+			if e = builtIn[kind]; e == nil {
+				if e = newBuiltInExecutor(kind, r.config, r.transports); e != nil {
+					r.executors = append(r.executors, e)
+					builtIn[kind] = e
+				}
+			}
+		}
+		if e == nil {
+			r.invalidRequest(req, fmt.Errorf("no executor for url scheme %q", scheme))
+			continue
+		}
+
+		if err := e.Prepare(req); err != nil {
+			r.invalidRequest(req, err)
+			continue
+		}
+		req.executor = e
+		req.index = len(prepared)
+		prepared = append(prepared, req)
+	}
+
+	r.requests = prepared
+	return nil
+}
+
+// closeExecutors closes every executor of the test
+func (r *Runner) closeExecutors() {
+	for _, e := range r.executors {
+		if err := e.Close(); err != nil {
+			r.logf("Error: could not close executor: %v\n", err)
+		}
+	}
+}
+
+// session is implemented by the built-in executors of requests that span
+// many exchanges, WebSocket scripts and streams. They are given the request
+// without its timeout, apply it to every exchange themselves and record
+// what they send and receive as it happens, through the recorder in ctx.
+type session interface {
+	Executor
+	session()
+}
+
+// recorder records the messages and events of a session as they happen.
+// Its methods do nothing if the session runs outside a load test.
+type recorder struct {
+	window *shardWindow // picked when the session started
+	index  int          // of the request
+}
+
+type recorderKey struct{}
+
+func withRecorder(ctx context.Context, rec *recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, rec)
+}
+
+func recorderFrom(ctx context.Context) *recorder {
+	rec, _ := ctx.Value(recorderKey{}).(*recorder)
+	return rec
+}
+
+func (rec *recorder) request(sent uint64) {
+	if rec != nil {
+		rec.window.recordRequest(rec.index, sent)
+	}
+}
+
+func (rec *recorder) response(resp Response) {
+	if rec != nil {
+		rec.window.recordResponse(rec.index, resp)
+	}
+}
+
+func (rec *recorder) connect(d time.Duration) {
+	if rec != nil {
+		rec.window.recordConnect(uint64(d.Milliseconds()))
+	}
+}
+
+// event records an event of a stream, d after the previous one or after
+// the request for the first
+func (rec *recorder) event(first bool, d time.Duration) {
+	if rec == nil {
+		return
+	}
+	if first {
+		rec.window.recordFirstEvent(uint64(d.Milliseconds()))
+	} else {
+		rec.window.recordEventGap(uint64(d.Milliseconds()))
+	}
+}
+
+// droppedError is returned by sessions whose connection broke off after
+// messages were exchanged over it
+type droppedError struct {
+	messages int
+	err      error
+}
+
+func (e *droppedError) Error() string {
+	return fmt.Sprintf("dropped after %d messages: %v", e.messages, e.err)
+}
+
+func (e *droppedError) Unwrap() error {
+	return e.err
+}
+
+// execute sends a request with its executor and records what came back
+func (c *client) execute(request *Request) {
+	ctx := c.reqCtx
+	_, isSession := request.executor.(session)
+	if timeout := c.requestTimeout(request); timeout > 0 && !isSession {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if request.proxy != nil {
+		ctx = withProxy(ctx, request.proxy)
+	}
+
+	startTime := time.Now()
+	w := c.shard.window()
+	if isSession {
+		ctx = withRecorder(ctx, &recorder{window: w, index: request.index})
+	} else {
+		w.recordRequest(request.index, 0)
+	}
+	result := request.executor.Execute(ctx, request)
+	if !isSession {
+		w.recordSent(request.index, result.BytesSent)
+	}
+
+	err := result.Err
+	if err != nil && c.reqCtx.Err() != nil {
+		// aborted at the end of the test, not the server's fault
+		return
+	}
+	if request.operation > 0 {
+		w.recordOperation(request.operation, result)
+	}
+	if err != nil {
+		c.reportFailure(ctx, w, request, startTime, err)
+		return
+	}
+
+	if !isSession {
+		w.recordResponse(request.index, Response{
+			StatusCode:    result.Status,
+			ResponseTime:  result.Latency.Milliseconds(),
+			Timestamp:     startTime.UnixNano(),
+			Body:          result.Body,
+			Proto:         result.Proto,
+			BytesSent:     result.BytesSent,
+			BytesReceived: result.BytesReceived,
+		})
+	}
+
+	if result.Failed {
+		c.reportError(w, ResponseError{
+			Timestamp:  startTime.UnixNano(),
+			Verb:       request.Verb,
+			URL:        request.URL,
+			StatusCode: result.Status,
+			Status:     result.StatusText,
+			Request:    request,
+			Body:       result.Body,
+		})
+	}
+}
+
+// reportFailure reports a request that got no response as dropped, timed
+// out or failed on the network
+func (c *client) reportFailure(ctx context.Context, w *shardWindow, request *Request, startTime time.Time, err error) {
+	var dropped *droppedError
+	switch {
+	case errors.As(err, &dropped):
+		c.reportError(w, DroppedConnectionError{
+			Timestamp: startTime.UnixNano(),
+			Verb:      request.Verb,
+			URL:       request.URL,
+			Request:   request,
+			Messages:  dropped.messages,
+			Error:     dropped.err,
+		})
+	case ctx.Err() == context.DeadlineExceeded || errors.Is(err, context.DeadlineExceeded):
+		c.reportError(w, TimeoutError{
+			Timestamp: startTime.UnixNano(),
+			Verb:      request.Verb,
+			URL:       request.URL,
+			Request:   request,
+			Timeout:   c.requestTimeout(request),
+		})
+	default:
+		c.reportError(w, NetworkError{
+			Timestamp: startTime.UnixNano(),
+			Verb:      request.Verb,
+			URL:       request.URL,
+			Request:   request,
+			Error:     err,
+			Category:  classifyError(err),
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+// graphqlErrorStatus marks responses whose status code was fine but whose
+// body carried GraphQL errors
+const graphqlErrorStatus = "GraphQL errors"
+
+// anonymousOperation groups GraphQL requests without an operation name
+const anonymousOperation = "(anonymous)"
+
+// graphqlBody is what a GraphQL request posts
+type graphqlBody struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+func isGraphQL(req *Request) bool {
+	return req.Verb == "GRAPHQL" || req.Query != ""
+}
+
+// prepareGraphQL checks a GraphQL request and encodes the body it posts
+func (req *Request) prepareGraphQL() error {
+	req.Verb = "GRAPHQL"
+	if req.Query == "" {
+		return fmt.Errorf("a GraphQL request needs a query")
+	}
+	if !strings.HasPrefix(req.URL, "http://") && !strings.HasPrefix(req.URL, "https://") && !strings.HasPrefix(req.URL, "unix://") {
+		return fmt.Errorf("a GraphQL request needs an http://, https:// or unix:// url")
+	}
+
+	b, err := json.Marshal(graphqlBody{
+		Query:         req.Query,
+		Variables:     req.Variables,
+		OperationName: req.OperationName,
+	})
+	if err != nil {
+		return fmt.Errorf("could not encode GraphQL variables: %w", err)
+	}
+	req.BodyBytes = b
+
+	if _, ok := req.header("Content-Type"); !ok {
+		if req.Headers == nil {
+			req.Headers = make(map[string]string)
+		}
+		req.Headers["Content-Type"] = "application/json"
+	}
+	return nil
+}
+
+// header looks a header of the request up regardless of its case
+func (req *Request) header(name string) (string, bool) {
+	for k, v := range req.Headers {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// operationName is the name GraphQL stats are grouped under
+func (req *Request) operationName() string {
+	if req.OperationName == "" {
+		return anonymousOperation
+	}
+	return req.OperationName
+}
+
+// assignOperations gives every GraphQL request the stats slot of its
+// operation, shared by requests with the same operation name
+func (r *Runner) assignOperations() {
+	r.operations = nil
+	for _, req := range r.requests {
+		if !isGraphQL(req) {
+			continue
+		}
+		name := req.operationName()
+		slot := 0
+		for i, op := range r.operations {
+			if op == name {
+				slot = i + 1
+			}
+		}
+		if slot == 0 {
+			r.operations = append(r.operations, name)
+			slot = len(r.operations)
+		}
+		req.operation = slot
+	}
+}
+
+// readGraphQLErrors decodes a GraphQL response and returns the start of its
+// errors, or nothing if there are none
+func readGraphQLErrors(body io.Reader) string {
+	var result struct {
+		Errors []json.RawMessage `json:"errors"`
+	}
+	if err := json.NewDecoder(body).Decode(&result); err != nil || len(result.Errors) == 0 {
+		return ""
+	}
+
+	b, _ := json.Marshal(result.Errors)
+	if len(b) > maxErrorBodySize {
+		return string(b[:maxErrorBodySize]) + "… (truncated)"
+	}
+	return string(b)
+}
+
+// operationCounts holds the outcomes of a single GraphQL operation
+type operationCounts struct {
+	requests  uint64
+	responses uint64
+	errors    uint64
+	latency   lazyHistogram
+}
+
+// operationTotals is the merged content of many operationCounts
+type operationTotals struct {
+	requests  uint64
+	responses uint64
+	errors    uint64
+	latency   Histogram
+}
+
+// recordOperation counts a GraphQL request towards its operation. Failed
+// responses and requests that got none count as errors.
+func (w *shardWindow) recordOperation(operation int, result Result) {
+	o := &w.operations[operation-1]
+	atomic.AddUint64(&o.requests, 1)
+	if result.Err != nil {
+		atomic.AddUint64(&o.errors, 1)
+		return
+	}
+
+	atomic.AddUint64(&o.responses, 1)
+	o.latency.record(uint64(result.Latency.Milliseconds()))
+	if result.Failed {
+		atomic.AddUint64(&o.errors, 1)
+	}
+}
+
+func (t *windowTotals) growOperations(n int) {
+	if len(t.operations) < n {
+		t.operations = append(t.operations, make([]operationTotals, n-len(t.operations))...)
+	}
+}
@@ -0,0 +1,507 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// reflectionTimeout caps how long resolving a method over server reflection
+// may take before the test starts
+const reflectionTimeout = 10 * time.Second
+
+// grpcCall is a gRPC request resolved against its service descriptor
+type grpcCall struct {
+	target   *grpcTarget
+	path     string // /package.Service/Method
+	method   protoreflect.MethodDescriptor
+	messages []proto.Message
+	size     uint64 // encoded size of all messages
+}
+
+// grpcConns shares one connection per target between all clients
+type grpcConns struct {
+	mu    sync.Mutex
+	conns map[string]*grpcTarget
+}
+
+// grpcTarget is the connection to a gRPC server
+type grpcTarget struct {
+	conn *grpc.ClientConn
+
+	// the last failed dial, gRPC only passes its text on to calls
+	dialErr atomic.Pointer[error]
+}
+
+// prepareGRPC checks a gRPC request. The method is resolved later, once
+// the transports exist.
+func (req *Request) prepareGRPC() error {
+	if req.Verb == "" {
+		req.Verb = "GRPC"
+	}
+	if req.Target == "" {
+		return fmt.Errorf("gRPC request without a target")
+	}
+	if _, _, err := splitGRPCMethod(req.Method); err != nil {
+		return err
+	}
+	if req.URL == "" {
+		req.URL = "grpc://" + req.Target + "/" + strings.TrimPrefix(req.Method, "/")
+	}
+	return req.prepareMessages()
+}
+
+func isGRPC(req *Request) bool {
+	return req.Verb == "GRPC" || (req.Verb == "" && req.Target != "")
+}
+
+// splitGRPCMethod accepts package.Service/Method, /package.Service/Method
+// and package.Service.Method
+func splitGRPCMethod(method string) (string, string, error) {
+	method = strings.TrimPrefix(method, "/")
+	i := strings.LastIndex(method, "/")
+	if i < 0 {
+		i = strings.LastIndex(method, ".")
+	}
+	if i <= 0 || i == len(method)-1 {
+		return "", "", fmt.Errorf("invalid gRPC method %q: expected package.Service/Method", method)
+	}
+	return method[:i], method[i+1:], nil
+}
+
+func (t *transports) grpcConn(target string, useTLS bool) (*grpcTarget, error) {
+	t.grpc.mu.Lock()
+	defer t.grpc.mu.Unlock()
+
+	key := fmt.Sprintf("%t|%s", useTLS, target)
+	if conn, ok := t.grpc.conns[key]; ok {
+		return conn, nil
+	}
+	g := &grpcTarget{}
+
+	creds := insecure.NewCredentials()
+	if useTLS {
+		creds = credentials.NewTLS(t.tls.Clone())
+	}
+
+	conn, err := grpc.Dial(target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			conn, err := t.dialer.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				g.dialErr.Store(&err)
+			} else {
+				g.dialErr.Store(nil)
+			}
+			return conn, err
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	g.conn = conn
+
+	if t.grpc.conns == nil {
+		t.grpc.conns = make(map[string]*grpcTarget)
+	}
+	t.grpc.conns[key] = g
+	return g, nil
+}
+
+func (t *transports) close() {
+	t.grpc.mu.Lock()
+	defer t.grpc.mu.Unlock()
+
+	for _, g := range t.grpc.conns {
+		g.conn.Close()
+	}
+	t.grpc.conns = nil
+}
+
+// resolveGRPC connects a gRPC request and looks its method up in the
+// protoset or, without one, over server reflection
+func (t *transports) resolveGRPC(req *Request) error {
+	target, err := t.grpcConn(req.Target, req.TLS)
+	if err != nil {
+		return err
+	}
+
+	service, _, _ := splitGRPCMethod(req.Method)
+
+	var files *protoregistry.Files
+	if req.Protoset != "" {
+		files, err = loadProtoset(req.Protoset)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), reflectionTimeout)
+		defer cancel()
+		files, err = reflectFiles(ctx, target.conn, service)
+	}
+	if err != nil {
+		return err
+	}
+
+	call, err := newGRPCCall(files, req)
+	if err != nil {
+		return err
+	}
+	call.target = target
+	req.grpc = call
+	return nil
+}
+
+// newGRPCCall looks the method of a gRPC request up in files and decodes
+// the messages it sends
+func newGRPCCall(files *protoregistry.Files, req *Request) (*grpcCall, error) {
+	service, method, _ := splitGRPCMethod(req.Method)
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found: %w", service, err)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("method %s not found in service %s", method, service)
+	}
+
+	call := &grpcCall{
+		path:   "/" + service + "/" + method,
+		method: md,
+	}
+
+	// streams send the messages, unary calls the body
+	inputs := make([][]byte, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		inputs = append(inputs, m.bytes)
+	}
+	if len(inputs) == 0 || !md.IsStreamingClient() {
+		inputs = [][]byte{req.BodyBytes}
+	}
+
+	for i, in := range inputs {
+		msg := dynamicpb.NewMessage(md.Input())
+		if len(in) > 0 && string(in) != "null" {
+			if err := protojson.Unmarshal(in, msg); err != nil {
+				return nil, fmt.Errorf("message %d does not match %s: %w", i, md.Input().FullName(), err)
+			}
+		}
+		call.messages = append(call.messages, msg)
+		call.size += uint64(proto.Size(msg))
+	}
+	return call, nil
+}
+
+func loadProtoset(path string) (*protoregistry.Files, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read protoset: %w", err)
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("could not parse protoset %s: %w", path, err)
+	}
+
+	return buildFiles(set.File)
+}
+
+// reflectFiles asks the server for the file defining service and all the
+// files it imports
+func reflectFiles(ctx context.Context, conn *grpc.ClientConn, service string) (*protoregistry.Files, error) {
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("server reflection failed: %w", err)
+	}
+	defer stream.CloseSend()
+
+	var fds []*descriptorpb.FileDescriptorProto
+	seen := make(map[string]bool)
+	var missing []string
+
+	ask := func(req *rpb.ServerReflectionRequest) error {
+		if err := stream.Send(req); err != nil {
+			return err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return errors.New(e.GetErrorMessage())
+		}
+
+		for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, fd); err != nil {
+				return err
+			}
+			if seen[fd.GetName()] {
+				continue
+			}
+			seen[fd.GetName()] = true
+			fds = append(fds, fd)
+			missing = append(missing, fd.GetDependency()...)
+		}
+		return nil
+	}
+
+	err = ask(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("server reflection failed: %w", err)
+	}
+
+	for len(missing) > 0 {
+		name := missing[0]
+		missing = missing[1:]
+		if seen[name] {
+			continue
+		}
+		if _, err := protoregistry.GlobalFiles.FindFileByPath(name); err == nil {
+			continue
+		}
+		err = ask(&rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("server reflection failed for %s: %w", name, err)
+		}
+	}
+
+	return buildFiles(fds)
+}
+
+// buildFiles registers file descriptors after the files they import, taking
+// well known types from the linked in registry when they are missing
+func buildFiles(fds []*descriptorpb.FileDescriptorProto) (*protoregistry.Files, error) {
+	byName := make(map[string]*descriptorpb.FileDescriptorProto, len(fds))
+	for _, fd := range fds {
+		byName[fd.GetName()] = fd
+	}
+
+	files := new(protoregistry.Files)
+
+	var add func(name string) error
+	add = func(name string) error {
+		if _, err := files.FindFileByPath(name); err == nil {
+			return nil
+		}
+
+		fd, ok := byName[name]
+		if !ok {
+			f, err := protoregistry.GlobalFiles.FindFileByPath(name)
+			if err != nil {
+				return fmt.Errorf("missing proto file %s", name)
+			}
+			return files.RegisterFile(f)
+		}
+
+		for _, dep := range fd.GetDependency() {
+			if err := add(dep); err != nil {
+				return err
+			}
+		}
+
+		f, err := protodesc.NewFile(fd, files)
+		if err != nil {
+			return err
+		}
+		return files.RegisterFile(f)
+	}
+
+	for _, fd := range fds {
+		if err := add(fd.GetName()); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// grpcExecutor makes the unary and streaming calls of gRPC requests. A call
+// counts as one request and one response however many messages it streams.
+type grpcExecutor struct{}
+
+func (e *grpcExecutor) Prepare(req *Request) error {
+	if req.proxy != nil {
+		return fmt.Errorf("gRPC requests can't be sent through a proxy")
+	}
+	if err := req.prepareGRPC(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(req.Body)
+	if err != nil {
+		return errors.New("could not parse request body")
+	}
+	req.BodyBytes = b
+	return nil
+}
+
+func (e *grpcExecutor) Execute(ctx context.Context, request *Request) Result {
+	call := request.grpc
+	for k, v := range request.Headers {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(k), v)
+	}
+
+	startTime := time.Now()
+	received, err := call.invoke(ctx, request, nil)
+
+	// calls cut short by their context fail with a status too
+	st, isStatus := status.FromError(err)
+	if err != nil && (!isStatus || ctx.Err() != nil) {
+		return Result{BytesSent: call.size, Err: err}
+	}
+
+	result := Result{
+		Status:        int(st.Code()),
+		Latency:       time.Since(startTime),
+		Proto:         protocolNames[protoGRPC],
+		BytesSent:     call.size,
+		BytesReceived: received,
+	}
+	if st.Code() != codes.OK {
+		result.Failed = true
+		result.StatusText = grpcStatusText(st.Code())
+		result.Body = st.Message()
+	}
+	return result
+}
+
+func (e *grpcExecutor) Close() error {
+	return nil
+}
+
+// invoke makes the call of a request and returns the encoded size of its
+// replies, each of which is also passed to reply unless it is nil. A call
+// the server ended fails with its status, one that never got an answer
+// with the error underneath.
+func (call *grpcCall) invoke(ctx context.Context, request *Request, reply func(proto.Message)) (uint64, error) {
+	// the server answers with headers, trailers or both
+	var header, trailer metadata.MD
+	opts := []grpc.CallOption{grpc.Header(&header), grpc.Trailer(&trailer)}
+
+	received, err := call.send(ctx, request, reply, opts)
+	if err != nil && len(header) == 0 && len(trailer) == 0 {
+		err = call.target.transportError(err)
+	}
+	return received, err
+}
+
+// transportError turns the status gRPC makes up for a call that didn't
+// reach the server back into the error it stands for
+func (t *grpcTarget) transportError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.DeadlineExceeded:
+		return fmt.Errorf("%s: %w", st.Message(), context.DeadlineExceeded)
+	case codes.Canceled:
+		return fmt.Errorf("%s: %w", st.Message(), context.Canceled)
+	}
+	if last := t.dialErr.Load(); last != nil {
+		return fmt.Errorf("%s: %w", st.Code(), *last)
+	}
+	return errors.New(st.Message())
+}
+
+// send makes a unary or streaming call
+func (call *grpcCall) send(ctx context.Context, request *Request, reply func(proto.Message), opts []grpc.CallOption) (uint64, error) {
+	if !call.method.IsStreamingClient() && !call.method.IsStreamingServer() {
+		out := dynamicpb.NewMessage(call.method.Output())
+		if err := call.target.conn.Invoke(ctx, call.path, call.messages[0], out, opts...); err != nil {
+			return 0, err
+		}
+		if reply != nil {
+			reply(out)
+		}
+		return uint64(proto.Size(out)), nil
+	}
+	return call.stream(ctx, request, reply, opts)
+}
+
+// stream sends the messages of a streaming call and reads every reply
+func (call *grpcCall) stream(ctx context.Context, request *Request, reply func(proto.Message), opts []grpc.CallOption) (uint64, error) {
+	desc := &grpc.StreamDesc{
+		ClientStreams: call.method.IsStreamingClient(),
+		ServerStreams: call.method.IsStreamingServer(),
+	}
+
+	// cancelling tears the stream down if it ends early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := call.target.conn.NewStream(ctx, desc, call.path, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, msg := range call.messages {
+		if i < len(request.Messages) && request.Messages[i].delay > 0 {
+			select {
+			case <-time.After(request.Messages[i].delay):
+			case <-ctx.Done():
+				return 0, status.FromContextError(ctx.Err()).Err()
+			}
+		}
+		if err := stream.SendMsg(msg); err != nil {
+			if err == io.EOF {
+				// the server ended the call, its status comes with RecvMsg
+				break
+			}
+			return 0, err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return 0, err
+	}
+
+	var received uint64
+	for {
+		out := dynamicpb.NewMessage(call.method.Output())
+		err := stream.RecvMsg(out)
+		if err == io.EOF {
+			return received, nil
+		}
+		if err != nil {
+			return received, err
+		}
+		received += uint64(proto.Size(out))
+		if reply != nil {
+			reply(out)
+		}
+	}
+}
+
+// grpcStatusText names a gRPC status code, e.g. gRPC Unavailable
+func grpcStatusText(code codes.Code) string {
+	return "gRPC " + code.String()
+}
@@ -0,0 +1,248 @@
+package core
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// bucket layout in milliseconds: 1ms wide below 100ms, 10ms below 1s,
+// 100ms below 10s, 1s below 60s and a single overflow bucket past that
+const (
+	exactBuckets    = 100
+	tensBuckets     = 90
+	hundredsBuckets = 90
+	secondsBuckets  = 50
+	numBuckets      = exactBuckets + tensBuckets + hundredsBuckets + secondsBuckets + 1
+)
+
+// LatencyBuckets are the exclusive upper bounds in milliseconds of the coarse
+// buckets used to show the response time distribution. Anything slower falls
+// into one extra overflow bucket.
+var LatencyBuckets = []uint64{5, 10, 25, 50, 100, 250, 500, 1000, 2500}
+
+// Histogram counts response times in milliseconds. Buckets get coarser as
+// latency grows, so it stays small and cheap to merge while keeping
+// percentiles accurate to a few percent.
+type Histogram struct {
+	counts [numBuckets]uint64
+	total  uint64
+	sum    uint64
+	min    uint64
+	max    uint64
+}
+
+func bucketIndex(ms uint64) int {
+	switch {
+	case ms < 100:
+		return int(ms)
+	case ms < 1000:
+		return exactBuckets + int((ms-100)/10)
+	case ms < 10000:
+		return exactBuckets + tensBuckets + int((ms-1000)/100)
+	case ms < 60000:
+		return exactBuckets + tensBuckets + hundredsBuckets + int((ms-10000)/1000)
+	default:
+		return numBuckets - 1
+	}
+}
+
+// bucketLowerBound returns the smallest value that falls into bucket i
+func bucketLowerBound(i int) uint64 {
+	switch {
+	case i < exactBuckets:
+		return uint64(i)
+	case i < exactBuckets+tensBuckets:
+		return 100 + uint64(i-exactBuckets)*10
+	case i < exactBuckets+tensBuckets+hundredsBuckets:
+		return 1000 + uint64(i-exactBuckets-tensBuckets)*100
+	default:
+		return 10000 + uint64(i-exactBuckets-tensBuckets-hundredsBuckets)*1000
+	}
+}
+
+// bucketUpperBound returns the largest value that falls into bucket i
+func bucketUpperBound(i int) uint64 {
+	if i == numBuckets-1 {
+		return math.MaxUint64
+	}
+	return bucketLowerBound(i+1) - 1
+}
+
+// Record adds a response time in milliseconds
+func (h *Histogram) Record(ms uint64) {
+	if h.total == 0 || ms < h.min {
+		h.min = ms
+	}
+	if ms > h.max {
+		h.max = ms
+	}
+	h.counts[bucketIndex(ms)]++
+	h.total++
+	h.sum += ms
+}
+
+// Merge adds all the samples of o to h
+func (h *Histogram) Merge(o *Histogram) {
+	if o.total == 0 {
+		return
+	}
+	if h.total == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.total += o.total
+	h.sum += o.sum
+}
+
+// Reset drops all samples
+func (h *Histogram) Reset() {
+	*h = Histogram{}
+}
+
+// Count returns the number of samples recorded
+func (h *Histogram) Count() uint64 {
+	return h.total
+}
+
+// Mean returns the average response time, zero if there are no samples
+func (h *Histogram) Mean() uint64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / h.total
+}
+
+// Min returns the fastest response time, zero if there are no samples
+func (h *Histogram) Min() uint64 {
+	return h.min
+}
+
+// Max returns the slowest response time
+func (h *Histogram) Max() uint64 {
+	return h.max
+}
+
+// Percentile returns the response time below which p percent of the samples
+// fall, zero if there are no samples
+func (h *Histogram) Percentile(p float64) uint64 {
+	if h.total == 0 {
+		return 0
+	}
+
+	target := uint64(math.Ceil(p / 100 * float64(h.total)))
+	if target == 0 {
+		target = 1
+	}
+
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= target {
+			upper := bucketUpperBound(i)
+			if upper > h.max {
+				return h.max
+			}
+			return upper
+		}
+	}
+
+	return h.max
+}
+
+// Distribution counts the samples falling below each of the given ascending
+// bounds and above the previous one, plus a final count for those past the
+// last bound. Bounds should line up with bucket edges to be exact.
+func (h *Histogram) Distribution(bounds []uint64) []uint64 {
+	dist := make([]uint64, len(bounds)+1)
+
+	b := 0
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		for b < len(bounds) && bucketLowerBound(i) >= bounds[b] {
+			b++
+		}
+		dist[b] += c
+	}
+
+	return dist
+}
+
+// atomicHistogram is a Histogram that many goroutines can record into
+// without locking. It is drained into a plain Histogram to be read.
+type atomicHistogram struct {
+	counts [numBuckets]uint64
+	sum    uint64
+	min    uint64 // stored plus one so zero means no samples
+	max    uint64
+}
+
+func (a *atomicHistogram) record(ms uint64) {
+	atomic.AddUint64(&a.counts[bucketIndex(ms)], 1)
+	atomic.AddUint64(&a.sum, ms)
+
+	for {
+		old := atomic.LoadUint64(&a.min)
+		if (old != 0 && old <= ms+1) || atomic.CompareAndSwapUint64(&a.min, old, ms+1) {
+			break
+		}
+	}
+
+	for {
+		old := atomic.LoadUint64(&a.max)
+		if old >= ms || atomic.CompareAndSwapUint64(&a.max, old, ms) {
+			break
+		}
+	}
+}
+
+// lazyHistogram is an atomicHistogram allocated on its first sample, since
+// a shard only sees a few of the protocols and request kinds it counts
+type lazyHistogram struct {
+	p atomic.Pointer[atomicHistogram]
+}
+
+func (l *lazyHistogram) record(ms uint64) {
+	a := l.p.Load()
+	if a == nil {
+		a = &atomicHistogram{}
+		if !l.p.CompareAndSwap(nil, a) {
+			a = l.p.Load()
+		}
+	}
+	a.record(ms)
+}
+
+// drain moves all recorded samples into h, if there are any
+func (l *lazyHistogram) drain(h *Histogram) {
+	if a := l.p.Load(); a != nil {
+		a.drain(h)
+	}
+}
+
+// drain moves all recorded samples into h and resets a
+func (a *atomicHistogram) drain(h *Histogram) {
+	var o Histogram
+	for i := range a.counts {
+		if atomic.LoadUint64(&a.counts[i]) == 0 {
+			continue
+		}
+		c := atomic.SwapUint64(&a.counts[i], 0)
+		o.counts[i] = c
+		o.total += c
+	}
+
+	o.sum = atomic.SwapUint64(&a.sum, 0)
+	o.max = atomic.SwapUint64(&a.max, 0)
+	if lowest := atomic.SwapUint64(&a.min, 0); lowest > 0 {
+		o.min = lowest - 1
+	}
+
+	h.Merge(&o)
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// httpExecutor sends http://, https:// and unix:// requests, GraphQL ones
+// included, over the shared HTTP client
+type httpExecutor struct {
+	t        *transports
+	protocol string // one of the Protocol constants
+}
+
+func (e *httpExecutor) Prepare(req *Request) error {
+	if err := checkProtocol(e.protocol, req); err != nil {
+		return err
+	}
+	if isGraphQL(req) {
+		return req.prepareGraphQL()
+	}
+	return req.prepareBody()
+}
+
+// prepareBody encodes the body of an HTTP request
+func (req *Request) prepareBody() error {
+	switch req.Verb {
+	case "GET", "POST", "PUT", "DELETE":
+		b, err := json.Marshal(req.Body)
+		if err != nil {
+			return fmt.Errorf("could not parse request body")
+		}
+		req.BodyBytes = b
+	default:
+		return fmt.Errorf("verb: %s not allowed. Only GET, POST, PUT, DELETE are allowed", req.Verb)
+	}
+	return nil
+}
+
+// newHTTPRequest builds the HTTP request a spec request is sent as
+func newHTTPRequest(ctx context.Context, request *Request) (*http.Request, error) {
+	var req *http.Request
+	var err error
+
+	switch request.Verb {
+	case "GET":
+		req, err = http.NewRequestWithContext(ctx, request.Verb, request.target, nil)
+	case "POST":
+		req, err = http.NewRequestWithContext(ctx, request.Verb, request.target, bytes.NewReader(request.BodyBytes))
+	case "PUT":
+		req, err = http.NewRequestWithContext(ctx, request.Verb, request.target, bytes.NewReader(request.BodyBytes))
+	case "DELETE":
+		req, err = http.NewRequestWithContext(ctx, request.Verb, request.target, nil)
+	case "GRAPHQL":
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, request.target, bytes.NewReader(request.BodyBytes))
+	default:
+		err = fmt.Errorf("verb: %s not allowed", request.Verb)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range request.Headers {
+		req.Header.Set(k, v)
+	}
+
+	// the client sends Host from the request rather than its headers
+	if host, ok := request.header("Host"); ok {
+		req.Host = host
+	} else if request.host != "" {
+		req.Host = request.host
+	}
+	return req, nil
+}
+
+func (e *httpExecutor) Execute(ctx context.Context, request *Request) Result {
+	req, err := newHTTPRequest(ctx, request)
+	if err != nil {
+		return Result{Err: err}
+	}
+
+	sent := requestSize(req)
+
+	startTime := time.Now()
+	resp, err := e.t.http.Do(req)
+	if err != nil {
+		return Result{BytesSent: sent, Err: err}
+	}
+
+	responseTime := time.Since(startTime)
+	defer resp.Body.Close()
+	if err = checkResponseProto(e.protocol, resp); err != nil {
+		return Result{BytesSent: sent, Err: err}
+	}
+
+	// the whole body is read so the transfer is measured and the
+	// connection can be reused
+	received := &countingWriter{}
+	body := io.TeeReader(resp.Body, received)
+
+	result := Result{
+		Status:  resp.StatusCode,
+		Latency: responseTime,
+		Proto:   resp.Proto,
+	}
+	switch {
+	case resp.StatusCode >= 300 || resp.StatusCode < 200:
+		result.Failed = true
+		result.Body = readErrorBody(body)
+	case request.operation > 0:
+		// GraphQL reports failed operations in the body of a 200
+		if result.Body = readGraphQLErrors(body); result.Body != "" {
+			result.Failed = true
+			result.StatusText = graphqlErrorStatus
+		}
+	}
+	if _, err = io.Copy(io.Discard, body); err != nil {
+		return Result{BytesSent: sent, Err: err}
+	}
+
+	result.BytesSent = sent
+	result.BytesReceived = responseHeaderSize(resp) + received.n
+	return result
+}
+
+func (e *httpExecutor) Close() error {
+	e.t.http.CloseIdleConnections()
+	return nil
+}
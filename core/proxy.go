@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// proxyKey carries a request's own proxy through its context
+type proxyKey struct{}
+
+func withProxy(ctx context.Context, proxy *url.URL) context.Context {
+	return context.WithValue(ctx, proxyKey{}, proxy)
+}
+
+func parseProxyURL(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", proxy, err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q: expected an http://, https:// or socks5:// URL", proxy)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", proxy)
+	}
+
+	return u, nil
+}
+
+// proxyFunc picks the proxy of a request: its own from the spec, then the
+// --proxy flag, then the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables.
+// Requests over a unix socket never go through one.
+func proxyFunc(config Config) (func(*http.Request) (*url.URL, error), error) {
+	if config.UnixSocket != "" {
+		if config.Proxy != "" {
+			return nil, fmt.Errorf("a proxy can't be used with a unix socket")
+		}
+		return func(*http.Request) (*url.URL, error) { return nil, nil }, nil
+	}
+
+	fallback := http.ProxyFromEnvironment
+	if config.Proxy != "" {
+		u, err := parseProxyURL(config.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		fallback = http.ProxyURL(u)
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		if strings.HasPrefix(req.URL.Hostname(), unixHostPrefix) {
+			return nil, nil
+		}
+		if u, ok := req.Context().Value(proxyKey{}).(*url.URL); ok {
+			return u, nil
+		}
+		return fallback(req)
+	}, nil
+}
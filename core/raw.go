@@ -0,0 +1,214 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxRawReply caps how much of a reply is read looking for its delimiter
+const maxRawReply = 64 * 1024
+
+// unexpectedReplyStatus marks replies that didn't match what was expected
+const unexpectedReplyStatus = "unexpected reply"
+
+// Payload is what a tcp:// or udp:// request sends, given as one of text,
+// hex encoded bytes or the contents of a file
+type Payload struct {
+	Text string `json:"text"`
+	Hex  string `json:"hex"`
+	File string `json:"file"`
+}
+
+// Reply tells a tcp:// or udp:// request to wait for a reply, which is
+// complete once it ends with Delimiter or is Length bytes long
+type Reply struct {
+	Delimiter string `json:"delimiter"`
+	Length    int    `json:"length"`
+}
+
+func isRawURL(url string) bool {
+	return strings.HasPrefix(url, "tcp://") || strings.HasPrefix(url, "udp://")
+}
+
+// prepareRaw checks a tcp:// or udp:// request and loads its payload
+func (req *Request) prepareRaw() error {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return err
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return fmt.Errorf("expected %s://host:port", u.Scheme)
+	}
+
+	switch req.Verb {
+	case "":
+		req.Verb = strings.ToUpper(u.Scheme)
+	case strings.ToUpper(u.Scheme):
+	default:
+		return fmt.Errorf("verb: %s not allowed for %s", req.Verb, u.Scheme)
+	}
+
+	p := req.Payload
+	if p == nil {
+		return fmt.Errorf("%s requests need a payload", u.Scheme)
+	}
+	switch {
+	case p.Text != "" && p.Hex == "" && p.File == "":
+		req.BodyBytes = []byte(p.Text)
+	case p.Hex != "" && p.Text == "" && p.File == "":
+		req.BodyBytes, err = hex.DecodeString(strings.ReplaceAll(p.Hex, " ", ""))
+		if err != nil {
+			return fmt.Errorf("invalid hex payload: %w", err)
+		}
+	case p.File != "" && p.Text == "" && p.Hex == "":
+		req.BodyBytes, err = os.ReadFile(p.File)
+		if err != nil {
+			return fmt.Errorf("could not read payload: %w", err)
+		}
+	default:
+		return fmt.Errorf("a payload needs exactly one of text, hex or file")
+	}
+
+	if r := req.Reply; r != nil {
+		if (r.Delimiter == "") == (r.Length == 0) || r.Length < 0 {
+			return fmt.Errorf("a reply needs either a delimiter or a length")
+		}
+		if r.Length > maxRawReply {
+			return fmt.Errorf("reply length: %d is over %d bytes", r.Length, maxRawReply)
+		}
+	}
+
+	req.raw = u.Scheme
+	req.target = u.Host
+	return nil
+}
+
+// rawExecutor sends the payload of tcp:// and udp:// requests and waits
+// for the reply if one is expected. Every connection is used once, so the
+// response time includes connecting.
+type rawExecutor struct {
+	t *transports
+}
+
+func (e *rawExecutor) Prepare(req *Request) error {
+	if req.proxy != nil {
+		return fmt.Errorf("%s requests can't be sent through a proxy", urlScheme(req.URL))
+	}
+	return req.prepareRaw()
+}
+
+func (e *rawExecutor) Execute(ctx context.Context, request *Request) Result {
+	startTime := time.Now()
+	sent := uint64(len(request.BodyBytes))
+
+	reply, err := e.t.sendRaw(ctx, request)
+	if err != nil && !errors.Is(err, errUnexpectedReply) {
+		return Result{BytesSent: sent, Err: err}
+	}
+
+	result := Result{
+		Latency:       time.Since(startTime),
+		Proto:         strings.ToUpper(request.raw),
+		BytesSent:     sent,
+		BytesReceived: uint64(len(reply)),
+	}
+	if err != nil {
+		body := reply
+		if len(body) > maxErrorBodySize {
+			body = body[:maxErrorBodySize]
+		}
+		result.Failed = true
+		result.StatusText = unexpectedReplyStatus
+		result.Body = fmt.Sprintf("%q", body)
+	}
+	return result
+}
+
+func (e *rawExecutor) Close() error {
+	return nil
+}
+
+var errUnexpectedReply = errors.New(unexpectedReplyStatus)
+
+// sendRaw sends the payload of a tcp:// or udp:// request over a new
+// connection and reads the reply if one is expected. A reply that doesn't
+// match is returned along with errUnexpectedReply.
+func (t *transports) sendRaw(ctx context.Context, request *Request) ([]byte, error) {
+	conn, err := t.dialer.DialContext(ctx, request.raw, request.target)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// unblock reads and writes once the request times out or the test ends
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	if _, err = conn.Write(request.BodyBytes); err != nil {
+		return nil, err
+	}
+	if request.Reply == nil {
+		return nil, nil
+	}
+	return readReply(conn, request.raw, request.Reply)
+}
+
+// readReply reads a reply off conn. Over UDP the reply is a single datagram
+// that has to match, over TCP it is read until it does.
+func readReply(conn net.Conn, network string, r *Reply) ([]byte, error) {
+	if network == "udp" {
+		buf := make([]byte, maxRawReply)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		reply := buf[:n]
+		if r.Length > 0 && n != r.Length || r.Delimiter != "" && !bytes.HasSuffix(reply, []byte(r.Delimiter)) {
+			return reply, errUnexpectedReply
+		}
+		return reply, nil
+	}
+
+	if r.Length > 0 {
+		reply := make([]byte, r.Length)
+		n, err := io.ReadFull(conn, reply)
+		return reply[:n], err
+	}
+
+	reader := bufio.NewReader(io.LimitReader(conn, maxRawReply))
+	delim := []byte(r.Delimiter)
+	var reply []byte
+	for {
+		b, err := reader.ReadBytes(delim[len(delim)-1])
+		reply = append(reply, b...)
+		if bytes.HasSuffix(reply, delim) {
+			return reply, nil
+		}
+		if err == io.EOF && len(reply) == maxRawReply {
+			return reply, errUnexpectedReply
+		}
+		if err == io.EOF {
+			return reply, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return reply, err
+		}
+	}
+}
@@ -3,48 +3,63 @@ package core
 import (
 	"context"
 	"encoding/json"
-	"io"
-	"log"
-	"math"
-	"os"
-	"path/filepath"
-	"reflect"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 )
 
 type Runner struct {
-	config   Config
-	ticker   *time.Ticker
-	requests []*Request
+	config     Config
+	ticker     *time.Ticker
+	requests   []*Request
+	transports *transports
+	sockets    map[string]string // made up host:port of unix socket URLs to the socket
+	operations []string          // GraphQL operation names, by stats slot minus one
+	executors  []Executor        // every executor requests are sent with
 
 	// concurrency sync
-	ctx    context.Context
-	Cancel context.CancelFunc
-	wg     *sync.WaitGroup
-
-	// request stats
-	reqCount     uint64
-	resCount     uint64
-	reqCountChan chan struct{}
-	resCountChan chan struct{}
-	ReqPS        chan uint64
-	ResPS        chan uint64
-
-	// error stats
-	errorCount   uint64
-	errIn        chan interface{}
-	ErrOut       chan interface{}
-	ErrCountChan chan uint64
-
-	// response time stats
-	resTimesIn  chan uint64
-	ResTimesOut chan uint64
-	ResStats    chan ResponseTimeStats
+	ctx      context.Context
+	Cancel   context.CancelFunc
+	wg       *sync.WaitGroup
+	clientWg *sync.WaitGroup
+
+	// in-flight requests are aborted once the grace period is over
+	reqCtx         context.Context
+	cancelRequests context.CancelFunc
+
+	// every client records into its own shard, merged on each tick
+	shards    []*shard
+	Snapshots chan Snapshot
+	ErrOut    chan interface{}
+
+	// live controls
+	ctl     *control
+	clients []context.CancelFunc
+	stopped bool
+
+	// warm-up samples are shown live but kept out of the stats
+	warmupEnd time.Time
+
+	// merged results
+	mu            sync.Mutex
+	totals        windowTotals // warm-up excluded
+	warmupLatency Histogram    // shown in place of the totals until warm-up ends
+	endTime       time.Time
 
 	// shutdown signal
 	Done chan struct{}
+
+	// Observer, if set before the test starts, is called with the snapshot
+	// of every tick from the goroutine merging them, so it sees all of them
+	// but holds the next tick back until it returns
+	Observer func(Snapshot)
+
+	fromMemory bool                   // requests were given to NewRunnerFromRequests
+	invalid    []*InvalidRequestError // requests left out of the test
 }
 
 type ResponseTimeStats struct {
@@ -53,254 +68,421 @@ type ResponseTimeStats struct {
 	MinTime     uint64
 }
 
+// LatencySnapshot holds the response time percentiles of the last tick and
+// the distribution of all response times so far
+type LatencySnapshot struct {
+	P50          uint64
+	P90          uint64
+	P99          uint64
+	Distribution []uint64 // counts per LatencyBuckets bucket plus overflow
+}
+
+// Snapshot is published on every tick with the state of the load test
+type Snapshot struct {
+	ReqPS         uint64
+	ResPS         uint64
+	SentPS        uint64                     // bytes sent in the last tick
+	ReceivedPS    uint64                     // bytes received in the last tick
+	Errors        uint64                     // warm-up excluded
+	Timeouts      uint64                     // warm-up excluded
+	NetworkErrors [NumErrorCategories]uint64 // by ErrorCategory, warm-up excluded
+	ResponseTimes ResponseTimeStats          // warm-up excluded
+	Latency       LatencySnapshot
+}
+
+// errorBacklog is how many error details can wait for the dashboard before
+// new ones are dropped. Errors are always counted.
+const errorBacklog = 1024
+
 func NewRunner(config Config, ticker *time.Ticker) *Runner {
 
 	return &Runner{
-		config:       config,
-		ticker:       ticker,
-		wg:           &sync.WaitGroup{},
-		reqCountChan: make(chan struct{}, config.NumClients),
-		resCountChan: make(chan struct{}, config.NumClients),
-		ReqPS:        make(chan uint64),
-		ResPS:        make(chan uint64),
-		errIn:        make(chan interface{}, config.NumClients),
-		ErrOut:       make(chan interface{}, config.NumClients),
-		ErrCountChan: make(chan uint64),
-		resTimesIn:   make(chan uint64, config.NumClients),
-		ResTimesOut:  make(chan uint64, config.NumClients),
-		ResStats:     make(chan ResponseTimeStats, config.NumClients),
-		Done:         make(chan struct{}),
+		config:    config,
+		ticker:    ticker,
+		wg:        &sync.WaitGroup{},
+		clientWg:  &sync.WaitGroup{},
+		ctl:       newControl(),
+		Snapshots: make(chan Snapshot, 1),
+		ErrOut:    make(chan interface{}, errorBacklog),
+		Done:      make(chan struct{}),
 	}
 }
 
-func (r *Runner) getRequestSpec() {
-	ext := filepath.Ext(r.config.ReqSpecPath)
-	if ext != ".json" {
-		log.Fatal("Invalid file format. Expected a JSON file.")
+// NewRunnerFromRequests returns a runner for requests built in memory
+// instead of read from config.ReqSpecPath, to run blitz from Go code such as
+// a test suite. The runner works on copies, so the requests can be reused.
+// A zero duration or number of clients falls back to a minute and a single
+// client.
+func NewRunnerFromRequests(requests []*Request, config Config) *Runner {
+	if config.Duration <= 0 {
+		config.Duration = time.Minute
 	}
-
-	reqSpec, err := os.Open(r.config.ReqSpecPath)
-	if err != nil {
-		log.Fatalf("Could not open file: %v", err)
+	if config.NumClients <= 0 {
+		config.NumClients = 1
 	}
 
-	defer reqSpec.Close()
+	r := NewRunner(config, time.NewTicker(time.Second))
+	r.requests = make([]*Request, len(requests))
+	for i, req := range requests {
+		r.requests[i] = req.clone()
+	}
+	r.fromMemory = true
+	return r
+}
 
-	bytes, err := io.ReadAll(reqSpec)
+func (r *Runner) getRequestSpec() error {
+	path := r.config.ReqSpecPath
+	spec, err := readSpec(path)
 	if err != nil {
-		log.Fatalf("Error reading file: %v", err)
+		return err
 	}
 
-	err = json.Unmarshal(bytes, &r.requests)
-	if err != nil {
-		log.Fatalf("Error parsing json file: %v", err)
+	if err = json.Unmarshal(spec, &r.requests); err != nil {
+		return newSpecParseError(path, spec, err)
 	}
+	return nil
+}
+
+// prepareRequest checks a request of the spec and readies it to be sent,
+// returning why it can't be otherwise
+func (r *Runner) prepareRequest(req *Request) error {
+	var err error
+	req.target = req.URL
+
+	if req.Timeout != "" {
+		req.timeout, err = time.ParseDuration(req.Timeout)
+		if err != nil || req.timeout <= 0 {
+			return fmt.Errorf("invalid timeout: %s", req.Timeout)
+		}
+	}
+	if req.Proxy != "" {
+		req.proxy, err = parseProxyURL(req.Proxy)
+		if err != nil {
+			return err
+		}
+	}
+	if req.proxy != nil && (r.config.UnixSocket != "" || strings.HasPrefix(req.URL, "unix://")) {
+		return fmt.Errorf("requests over a unix socket can't be sent through a proxy")
+	}
+	if strings.HasPrefix(req.URL, "unix://") {
+		socket, path, err := parseUnixURL(req.URL)
+		if err != nil {
+			return err
+		}
+		req.target = "http://" + r.socketHost(socket) + path
+		req.host = unixHost
+	}
+	return nil
 }
 
 func (r *Runner) validateRequests() {
 	validRequests := make([]*Request, 0)
 
-	for _, req := range r.requests {
-		switch req.Verb {
-		case "GET", "POST", "PUT", "DELETE":
-			bodyBytes, err := json.Marshal(req.Body)
-			if err != nil {
-				log.Printf("Error: could not parse request body for verb: %s\turl: %s\n", req.Verb, req.URL)
-				continue
-			}
-			req.BodyBytes = bodyBytes
-			validRequests = append(validRequests, req)
-		default:
-			log.Printf("Error: verb: %s not allowed. Only GET, POST, PUT, DELETE are allowed\n", req.Verb)
+	for i, req := range r.requests {
+		if req == nil {
+			r.invalidRequest(&Request{specIndex: i}, errors.New("empty request"))
+			continue
+		}
+		req.specIndex = i
+		if err := r.prepareRequest(req); err != nil {
+			r.invalidRequest(req, err)
 			continue
 		}
+		req.index = len(validRequests)
+		validRequests = append(validRequests, req)
 	}
 
-	log.Printf("total requests 🔢: %d\n", len(r.requests))
-	log.Printf("valid requests ✅: %d\n", len(validRequests))
-
 	r.requests = validRequests
 }
 
-func (r *Runner) initCounters() {
-	r.wg.Add(1)
+// resolveGRPC looks up the methods of the requests sent by the built-in gRPC
+// executor, dropping those that can't be resolved
+func (r *Runner) resolveGRPC() {
+	resolved := make([]*Request, 0, len(r.requests))
+	for _, req := range r.requests {
+		if _, ok := req.executor.(*grpcExecutor); ok {
+			if err := r.transports.resolveGRPC(req); err != nil {
+				r.invalidRequest(req, err)
+				continue
+			}
+		}
+		req.index = len(resolved)
+		resolved = append(resolved, req)
+	}
 
-	// reqs counter
-	go func(ctx context.Context) {
-		defer r.wg.Done()
+	r.requests = resolved
+}
 
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case _, ok := <-r.reqCountChan:
-				if !ok {
-					return
-				}
-				atomic.AddUint64(&r.reqCount, 1)
-			}
+// socketHost returns the made up host requests to a unix socket are sent to,
+// one per socket so their connections are pooled apart
+func (r *Runner) socketHost(socket string) string {
+	if r.sockets == nil {
+		r.sockets = make(map[string]string)
+	}
+	for addr, s := range r.sockets {
+		if s == socket {
+			host, _, _ := net.SplitHostPort(addr)
+			return host
 		}
-	}(r.ctx)
+	}
 
-	r.wg.Add(1)
+	host := unixHostPrefix + strconv.Itoa(len(r.sockets))
+	r.sockets[net.JoinHostPort(host, "80")] = socket
+	return host
+}
 
-	// res counter
-	go func(ctx context.Context) {
-		defer r.wg.Done()
+func responseTimeStats(h *Histogram) ResponseTimeStats {
+	return ResponseTimeStats{
+		AverageTime: h.Mean(),
+		MaxTime:     h.Max(),
+		MinTime:     h.Min(),
+	}
+}
 
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case _, ok := <-r.resCountChan:
-				if !ok {
-					return
-				}
-				atomic.AddUint64(&r.resCount, 1)
+// merge drains every shard into the totals and returns what happened since
+// the previous merge
+func (r *Runner) merge() Snapshot {
+	// draining doesn't need the lock, so the controls never wait on it
+	r.mu.Lock()
+	shards := r.shards
+	r.mu.Unlock()
+
+	var warmup, steady windowTotals
+	var retired map[*shard]bool
+	for _, s := range shards {
+		// checked first, so nothing recorded before retiring is missed
+		if s.isRetired() {
+			if retired == nil {
+				retired = make(map[*shard]bool)
 			}
+			retired[s] = true
 		}
-	}(r.ctx)
+		s.warmup.drain(&warmup)
+		s.steady.drain(&steady)
+	}
 
-	r.wg.Add(1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	// error counter
-	go func(ctx context.Context) {
-		defer r.wg.Done()
+	if len(retired) > 0 {
+		r.pruneShards(retired)
+	}
 
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case err, ok := <-r.errIn:
-				if !ok {
-					return
-				}
-				atomic.AddUint64(&r.errorCount, 1)
-				r.ErrCountChan <- r.errorCount
-				r.ErrOut <- err
-			}
+	r.totals.add(&steady)
+
+	window := warmup
+	window.add(&steady)
+	// the distribution covers the warm-up while it lasts, then only the stats
+	distribution := &r.totals.latency
+	if time.Now().Before(r.warmupEnd) {
+		r.warmupLatency.Merge(&warmup.latency)
+		distribution = &r.warmupLatency
+	}
+
+	return Snapshot{
+		ReqPS:         window.requests,
+		ResPS:         window.responses,
+		SentPS:        window.bytesSent,
+		ReceivedPS:    window.bytesReceived,
+		Errors:        r.totals.errors,
+		Timeouts:      r.totals.timeouts,
+		NetworkErrors: r.totals.networkErrors,
+		ResponseTimes: responseTimeStats(&r.totals.latency),
+		Latency: LatencySnapshot{
+			P50:          window.latency.Percentile(50),
+			P90:          window.latency.Percentile(90),
+			P99:          window.latency.Percentile(99),
+			Distribution: distribution.Distribution(LatencyBuckets),
+		},
+	}
+}
+
+// pruneShards drops the shards of clients that are gone and were drained
+// for the last time. A new slice is built, as merge may still be reading
+// the old one.
+func (r *Runner) pruneShards(retired map[*shard]bool) {
+	kept := make([]*shard, 0, len(r.shards))
+	for _, s := range r.shards {
+		if !retired[s] {
+			kept = append(kept, s)
 		}
-	}(r.ctx)
+	}
+	r.shards = kept
 }
 
-func (r *Runner) getRPS(ticker *time.Ticker) {
+// publish hands a snapshot over without waiting, replacing one that hasn't
+// been picked up yet so a slow dashboard never holds back the test
+func (r *Runner) publish(snapshot Snapshot) {
+	select {
+	case r.Snapshots <- snapshot:
+		return
+	default:
+	}
+
+	select {
+	case <-r.Snapshots:
+	default:
+	}
+
+	select {
+	case r.Snapshots <- snapshot:
+	default:
+	}
+}
+
+// observe passes a snapshot to the Observer and publishes it
+func (r *Runner) observe(snapshot Snapshot) {
+	if r.Observer != nil {
+		r.Observer(snapshot)
+	}
+	r.publish(snapshot)
+}
+
+// logf logs through the logger of the config, if there is one
+func (r *Runner) logf(format string, args ...interface{}) {
+	if r.config.Logger != nil {
+		r.config.Logger.Printf(format, args...)
+	}
+}
+
+func (r *Runner) aggregate() {
 	r.wg.Add(1)
 
 	go func(ctx context.Context) {
 		defer r.wg.Done()
+
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case _, ok := <-ticker.C:
-				if !ok {
-					return
-				}
-				reqC := atomic.SwapUint64(&r.reqCount, 0)
-				r.ReqPS <- reqC
-				resC := atomic.SwapUint64(&r.resCount, 0)
-				r.ResPS <- resC
+			case <-r.ticker.C:
+				r.observe(r.merge())
 			}
 		}
 	}(r.ctx)
 }
 
-func (r *Runner) getResponseTimesStats() {
-	r.wg.Add(1)
+// LoadTest starts the load test in the background. Its snapshots and errors
+// are published on Snapshots and ErrOut until Done is closed.
+func (r *Runner) LoadTest() error {
+	return r.start(context.Background())
+}
 
-	go func(ctx context.Context) {
-		defer r.wg.Done()
+// Run runs the load test and blocks until it is over, returning the results
+// without the warm-up. Cancelling ctx ends the test early, still giving
+// in-flight requests the grace period to finish.
+func (r *Runner) Run(ctx context.Context) (Summary, error) {
+	if err := r.start(ctx); err != nil {
+		return Summary{}, err
+	}
 
-		var numRes uint64
-		var resTimesSum uint64
-		var maxResTime uint64
-		var minResTime uint64 = math.MaxUint64
-		var avgResTime uint64
-		stats := ResponseTimeStats{
-			AverageTime: avgResTime,
-			MaxTime:     maxResTime,
-			MinTime:     minResTime,
-		}
+	// the observer is fed by the aggregator, the snapshots aren't needed
+	for range r.Snapshots {
+	}
+	<-r.Done
 
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case resTime, ok := <-r.resTimesIn:
-				if !ok {
-					return
-				}
-
-				r.ResTimesOut <- resTime
-
-				atomic.AddUint64(&numRes, 1)
-				atomic.AddUint64(&resTimesSum, resTime)
-				avg := resTimesSum / numRes
-				atomic.SwapUint64(&avgResTime, avg)
-
-				if resTime > maxResTime {
-					atomic.SwapUint64(&maxResTime, resTime)
-				}
-
-				if resTime < minResTime {
-					atomic.SwapUint64(&minResTime, resTime)
-				}
-
-				newStats := ResponseTimeStats{
-					AverageTime: avgResTime,
-					MaxTime:     maxResTime,
-					MinTime:     minResTime,
-				}
-
-				if !reflect.DeepEqual(stats, newStats) {
-					r.ResStats <- newStats
-					stats = newStats
-				}
-			}
-		}
-	}(r.ctx)
+	return r.Summary(), nil
 }
 
-func (r *Runner) LoadTest() {
-	r.getRequestSpec()
+// prepare reads and checks the requests and sets up the transports and
+// executors they are sent with. gRPC methods are only looked up if resolve
+// is set, since that can take the server.
+func (r *Runner) prepare(resolve bool) error {
+	if !r.fromMemory {
+		if err := r.getRequestSpec(); err != nil {
+			return err
+		}
+	}
 
+	total := len(r.requests)
 	r.validateRequests()
 
-	log.Println("starting load test 🏁")
+	transports, err := newTransports(r.config, r.sockets)
+	if err != nil {
+		return fmt.Errorf("invalid transport configuration: %w", err)
+	}
+	r.transports = transports
 
-	duration := r.config.Duration
-	ctx, cancel := context.WithTimeout(context.Background(), duration)
-	r.ctx = ctx
-	r.Cancel = cancel
+	err = r.prepareExecutors()
+	if err == nil && resolve {
+		r.resolveGRPC()
+	}
+	if err == nil {
+		r.logf("total requests 🔢: %d\n", total)
+		r.logf("valid requests ✅: %d\n", len(r.requests))
+	}
+	if err == nil && len(r.requests) == 0 {
+		err = &NoValidRequestsError{Invalid: r.invalid}
+	}
+	if err != nil {
+		r.transports.close()
+		r.closeExecutors()
+		return err
+	}
+	r.assignOperations()
+	return nil
+}
 
-	r.getRPS(r.ticker)
+// start prepares the requests and starts the clients, ending the test once
+// parent is done or the duration is over
+func (r *Runner) start(parent context.Context) error {
+	if err := r.prepare(true); err != nil {
+		r.ticker.Stop()
+		return err
+	}
 
-	r.initCounters()
+	r.logf("starting load test 🏁\n")
+	if r.config.Warmup > 0 {
+		r.logf("warming up for %v 🔥\n", r.config.Warmup)
+	}
 
-	r.getResponseTimesStats()
+	// the warm-up period runs ahead of the measured duration
+	duration := r.config.Warmup + r.config.Duration
+	r.warmupEnd = time.Now().Add(r.config.Warmup)
+	ctx, cancel := context.WithTimeout(parent, duration)
+	r.ctx = ctx
+	r.Cancel = cancel
+	r.reqCtx, r.cancelRequests = context.WithCancel(context.Background())
 
-	for i := 0; i < r.config.NumClients; i++ {
-		client := newClient(r.requests, r.ctx, r.wg, r.reqCountChan, r.resCountChan, r.resTimesIn, r.errIn)
-		client.start()
-	}
+	r.aggregate()
+
+	r.AddClients(r.config.NumClients)
 
 	// wait for all the goroutines to exit
 	go func() {
+		<-r.ctx.Done()
+
+		// no clients can be added from here on, and the test is over even
+		// if in-flight requests are still given the grace period
+		r.mu.Lock()
+		r.stopped = true
+		r.endTime = time.Now()
+		r.mu.Unlock()
+
+		// clients finish their in-flight requests once the context is done,
+		// unless they take longer than the grace period
+		abort := time.AfterFunc(r.config.Grace, func() {
+			r.logf("grace period of %v expired, aborting in-flight requests ⌛\n", r.config.Grace)
+			r.cancelRequests()
+		})
+		r.clientWg.Wait()
+		abort.Stop()
+		r.cancelRequests()
 		r.wg.Wait()
+		r.ticker.Stop()
+		r.transports.close()
+		r.closeExecutors()
+
+		// pick up what was recorded since the last tick
+		r.observe(r.merge())
 
 		// close data channels
-		close(r.reqCountChan)
-		close(r.resCountChan)
-		close(r.errIn)
+		close(r.Snapshots)
 		close(r.ErrOut)
-		close(r.ErrCountChan)
-		close(r.resTimesIn)
-		close(r.ResTimesOut)
-		close(r.ResStats)
-		close(r.ReqPS)
-		close(r.ResPS)
 
 		// finally close main done channel
 		close(r.Done)
 	}()
+
+	return nil
 }
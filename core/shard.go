@@ -0,0 +1,330 @@
+package core
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// endpointCounts holds the traffic of a single spec request
+type endpointCounts struct {
+	requests      uint64
+	responses     uint64
+	bytesSent     uint64
+	bytesReceived uint64
+}
+
+// protocolCounts holds the responses received over a single protocol
+type protocolCounts struct {
+	responses     uint64
+	bytesReceived uint64
+	latency       lazyHistogram
+}
+
+// status codes counted per response, HTTP ones below 600 and the 17 gRPC ones
+const (
+	numHTTPStatuses = 600
+	numGRPCStatuses = 17
+)
+
+// shardWindow holds what a client recorded since the last merge
+type shardWindow struct {
+	requests      uint64
+	responses     uint64
+	errors        uint64
+	timeouts      uint64
+	bytesSent     uint64
+	bytesReceived uint64
+	latency       lazyHistogram
+	endpoints     []endpointCounts // indexed like the spec requests
+	networkErrors [NumErrorCategories]uint64
+	protocols     [numProtocols]protocolCounts
+	httpStatuses  httpStatusCounts
+	grpcStatuses  [numGRPCStatuses]uint64
+	operations    []operationCounts // indexed by GraphQL operation slot minus one
+
+	// WebSocket connections
+	connects    uint64
+	connectTime lazyHistogram
+	drops       uint64
+
+	// streamed responses
+	events      uint64
+	firstEvent  lazyHistogram
+	eventGaps   lazyHistogram
+	streamDrops uint64
+}
+
+// httpStatusCounts counts responses per HTTP status code, allocated on the
+// first one since most shards never see any
+type httpStatusCounts struct {
+	p atomic.Pointer[[numHTTPStatuses]uint64]
+}
+
+func (c *httpStatusCounts) add(code int) {
+	counts := c.p.Load()
+	if counts == nil {
+		counts = new([numHTTPStatuses]uint64)
+		if !c.p.CompareAndSwap(nil, counts) {
+			counts = c.p.Load()
+		}
+	}
+	atomic.AddUint64(&counts[code], 1)
+}
+
+// drain moves the counts into t, if there are any
+func (c *httpStatusCounts) drain(t *[numHTTPStatuses]uint64) {
+	counts := c.p.Load()
+	if counts == nil {
+		return
+	}
+	for i := range counts {
+		if atomic.LoadUint64(&counts[i]) > 0 {
+			t[i] += atomic.SwapUint64(&counts[i], 0)
+		}
+	}
+}
+
+// shard is written to by a single client and read by the runner on every
+// tick, so recording never waits on other clients or on the dashboard
+type shard struct {
+	warmupEnd time.Time
+	warmup    shardWindow
+	steady    shardWindow
+
+	// set once the client is gone, the shard is dropped after its last drain
+	retired int32
+}
+
+func newShard(warmupEnd time.Time, numEndpoints, numOperations int) *shard {
+	return &shard{
+		warmupEnd: warmupEnd,
+		warmup: shardWindow{
+			endpoints:  make([]endpointCounts, numEndpoints),
+			operations: make([]operationCounts, numOperations),
+		},
+		steady: shardWindow{
+			endpoints:  make([]endpointCounts, numEndpoints),
+			operations: make([]operationCounts, numOperations),
+		},
+	}
+}
+
+// retire marks the shard as no longer written to
+func (s *shard) retire() {
+	atomic.StoreInt32(&s.retired, 1)
+}
+
+func (s *shard) isRetired() bool {
+	return atomic.LoadInt32(&s.retired) == 1
+}
+
+func (s *shard) inWarmup() bool {
+	return time.Now().Before(s.warmupEnd)
+}
+
+// window returns the window a request starting now is counted in. It is
+// picked once per request, so its response lands in the same one.
+func (s *shard) window() *shardWindow {
+	if s.inWarmup() {
+		return &s.warmup
+	}
+	return &s.steady
+}
+
+func (s *shard) isWarmup(w *shardWindow) bool {
+	return w == &s.warmup
+}
+
+func (w *shardWindow) recordRequest(endpoint int, bytes uint64) {
+	atomic.AddUint64(&w.requests, 1)
+	atomic.AddUint64(&w.bytesSent, bytes)
+	atomic.AddUint64(&w.endpoints[endpoint].requests, 1)
+	atomic.AddUint64(&w.endpoints[endpoint].bytesSent, bytes)
+}
+
+// recordSent adds the bytes of a request that was counted before they were known
+func (w *shardWindow) recordSent(endpoint int, bytes uint64) {
+	atomic.AddUint64(&w.bytesSent, bytes)
+	atomic.AddUint64(&w.endpoints[endpoint].bytesSent, bytes)
+}
+
+func (w *shardWindow) recordResponse(endpoint int, resp Response) {
+	ms := uint64(resp.ResponseTime)
+	atomic.AddUint64(&w.responses, 1)
+	atomic.AddUint64(&w.bytesReceived, resp.BytesReceived)
+	atomic.AddUint64(&w.endpoints[endpoint].responses, 1)
+	atomic.AddUint64(&w.endpoints[endpoint].bytesReceived, resp.BytesReceived)
+	w.latency.record(ms)
+
+	p := &w.protocols[protocolIndex(resp.Proto)]
+	atomic.AddUint64(&p.responses, 1)
+	atomic.AddUint64(&p.bytesReceived, resp.BytesReceived)
+	p.latency.record(ms)
+
+	code := resp.StatusCode
+	switch {
+	case protocolIndex(resp.Proto) == protoGRPC:
+		if code >= 0 && code < numGRPCStatuses {
+			atomic.AddUint64(&w.grpcStatuses[code], 1)
+		}
+	case code > 0 && code < numHTTPStatuses:
+		w.httpStatuses.add(code)
+	}
+}
+
+func (w *shardWindow) recordError() {
+	atomic.AddUint64(&w.errors, 1)
+}
+
+func (w *shardWindow) recordTimeout() {
+	atomic.AddUint64(&w.errors, 1)
+	atomic.AddUint64(&w.timeouts, 1)
+}
+
+func (w *shardWindow) recordConnect(ms uint64) {
+	atomic.AddUint64(&w.connects, 1)
+	w.connectTime.record(ms)
+}
+
+func (w *shardWindow) recordDrop() {
+	atomic.AddUint64(&w.errors, 1)
+	atomic.AddUint64(&w.drops, 1)
+}
+
+func (w *shardWindow) recordNetworkError(category ErrorCategory) {
+	atomic.AddUint64(&w.errors, 1)
+	atomic.AddUint64(&w.networkErrors[category], 1)
+}
+
+// protocolTotals is the merged content of many protocolCounts
+type protocolTotals struct {
+	responses     uint64
+	bytesReceived uint64
+	latency       Histogram
+}
+
+// windowTotals is the merged content of many shard windows
+type windowTotals struct {
+	requests      uint64
+	responses     uint64
+	errors        uint64
+	timeouts      uint64
+	bytesSent     uint64
+	bytesReceived uint64
+	latency       Histogram
+	endpoints     []endpointCounts
+	networkErrors [NumErrorCategories]uint64
+	protocols     [numProtocols]protocolTotals
+	httpStatuses  [numHTTPStatuses]uint64
+	grpcStatuses  [numGRPCStatuses]uint64
+	operations    []operationTotals
+	connects      uint64
+	connectTime   Histogram
+	drops         uint64
+	events        uint64
+	firstEvent    Histogram
+	eventGaps     Histogram
+	streamDrops   uint64
+}
+
+func (t *windowTotals) growEndpoints(n int) {
+	if len(t.endpoints) < n {
+		t.endpoints = append(t.endpoints, make([]endpointCounts, n-len(t.endpoints))...)
+	}
+}
+
+// drain moves the window into t and resets it
+func (w *shardWindow) drain(t *windowTotals) {
+	t.requests += atomic.SwapUint64(&w.requests, 0)
+	t.responses += atomic.SwapUint64(&w.responses, 0)
+	t.errors += atomic.SwapUint64(&w.errors, 0)
+	t.timeouts += atomic.SwapUint64(&w.timeouts, 0)
+	t.bytesSent += atomic.SwapUint64(&w.bytesSent, 0)
+	t.bytesReceived += atomic.SwapUint64(&w.bytesReceived, 0)
+	w.latency.drain(&t.latency)
+	for i := range w.networkErrors {
+		t.networkErrors[i] += atomic.SwapUint64(&w.networkErrors[i], 0)
+	}
+	for i := range w.protocols {
+		p := &w.protocols[i]
+		t.protocols[i].responses += atomic.SwapUint64(&p.responses, 0)
+		t.protocols[i].bytesReceived += atomic.SwapUint64(&p.bytesReceived, 0)
+		p.latency.drain(&t.protocols[i].latency)
+	}
+	w.httpStatuses.drain(&t.httpStatuses)
+	for i := range w.grpcStatuses {
+		t.grpcStatuses[i] += atomic.SwapUint64(&w.grpcStatuses[i], 0)
+	}
+	t.connects += atomic.SwapUint64(&w.connects, 0)
+	w.connectTime.drain(&t.connectTime)
+	t.drops += atomic.SwapUint64(&w.drops, 0)
+	t.events += atomic.SwapUint64(&w.events, 0)
+	w.firstEvent.drain(&t.firstEvent)
+	w.eventGaps.drain(&t.eventGaps)
+	t.streamDrops += atomic.SwapUint64(&w.streamDrops, 0)
+
+	t.growEndpoints(len(w.endpoints))
+	for i := range w.endpoints {
+		e := &w.endpoints[i]
+		t.endpoints[i].requests += atomic.SwapUint64(&e.requests, 0)
+		t.endpoints[i].responses += atomic.SwapUint64(&e.responses, 0)
+		t.endpoints[i].bytesSent += atomic.SwapUint64(&e.bytesSent, 0)
+		t.endpoints[i].bytesReceived += atomic.SwapUint64(&e.bytesReceived, 0)
+	}
+
+	t.growOperations(len(w.operations))
+	for i := range w.operations {
+		o := &w.operations[i]
+		t.operations[i].requests += atomic.SwapUint64(&o.requests, 0)
+		t.operations[i].responses += atomic.SwapUint64(&o.responses, 0)
+		t.operations[i].errors += atomic.SwapUint64(&o.errors, 0)
+		o.latency.drain(&t.operations[i].latency)
+	}
+}
+
+func (t *windowTotals) add(o *windowTotals) {
+	t.requests += o.requests
+	t.responses += o.responses
+	t.errors += o.errors
+	t.timeouts += o.timeouts
+	t.bytesSent += o.bytesSent
+	t.bytesReceived += o.bytesReceived
+	t.latency.Merge(&o.latency)
+	for i, c := range o.networkErrors {
+		t.networkErrors[i] += c
+	}
+	for i := range o.protocols {
+		t.protocols[i].responses += o.protocols[i].responses
+		t.protocols[i].bytesReceived += o.protocols[i].bytesReceived
+		t.protocols[i].latency.Merge(&o.protocols[i].latency)
+	}
+	for i, c := range o.httpStatuses {
+		t.httpStatuses[i] += c
+	}
+	for i, c := range o.grpcStatuses {
+		t.grpcStatuses[i] += c
+	}
+	t.connects += o.connects
+	t.connectTime.Merge(&o.connectTime)
+	t.drops += o.drops
+	t.events += o.events
+	t.firstEvent.Merge(&o.firstEvent)
+	t.eventGaps.Merge(&o.eventGaps)
+	t.streamDrops += o.streamDrops
+
+	t.growEndpoints(len(o.endpoints))
+	for i, e := range o.endpoints {
+		t.endpoints[i].requests += e.requests
+		t.endpoints[i].responses += e.responses
+		t.endpoints[i].bytesSent += e.bytesSent
+		t.endpoints[i].bytesReceived += e.bytesReceived
+	}
+
+	t.growOperations(len(o.operations))
+	for i := range o.operations {
+		t.operations[i].requests += o.operations[i].requests
+		t.operations[i].responses += o.operations[i].responses
+		t.operations[i].errors += o.operations[i].errors
+		t.operations[i].latency.Merge(&o.operations[i].latency)
+	}
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+var benchClients = []int{1, 100, 5000}
+
+var benchResponse = Response{
+	StatusCode:    200,
+	ResponseTime:  42,
+	Proto:         "HTTP/1.1",
+	BytesReceived: 512,
+}
+
+// BenchmarkShardRecord has every client record b.N requests and their
+// responses at once, each into its own shard, so an op is one of them
+// from every client
+func BenchmarkShardRecord(b *testing.B) {
+	for _, clients := range benchClients {
+		b.Run(fmt.Sprintf("clients=%d", clients), func(b *testing.B) {
+			shards := make([]*shard, clients)
+			for i := range shards {
+				shards[i] = newShard(time.Time{}, 4, 0)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := time.Now()
+
+			var wg sync.WaitGroup
+			for _, s := range shards {
+				wg.Add(1)
+				go func(s *shard) {
+					defer wg.Done()
+					for j := 0; j < b.N; j++ {
+						s.steady.recordRequest(j%4, 128)
+						s.steady.recordResponse(j%4, benchResponse)
+					}
+				}(s)
+			}
+			wg.Wait()
+			b.ReportMetric(float64(b.N*clients)/time.Since(start).Seconds(), "records/s")
+		})
+	}
+}
+
+// BenchmarkRunnerMerge merges the shards of every client after each of them
+// recorded a response, like a tick of a busy test
+func BenchmarkRunnerMerge(b *testing.B) {
+	for _, clients := range benchClients {
+		b.Run(fmt.Sprintf("clients=%d", clients), func(b *testing.B) {
+			r := &Runner{}
+			for i := 0; i < clients; i++ {
+				r.shards = append(r.shards, newShard(time.Time{}, 4, 0))
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				for _, s := range r.shards {
+					s.steady.recordRequest(i%4, 128)
+					s.steady.recordResponse(i%4, benchResponse)
+				}
+				b.StartTimer()
+
+				r.merge()
+			}
+		})
+	}
+}
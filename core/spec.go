@@ -0,0 +1,138 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SpecNotFoundError is returned when the request spec file doesn't exist
+type SpecNotFoundError struct {
+	Path string
+}
+
+func (e *SpecNotFoundError) Error() string {
+	return fmt.Sprintf("request spec %s not found", e.Path)
+}
+
+// SpecParseError is returned when the request spec isn't valid JSON or
+// doesn't hold a list of requests. Line and Column are 1-based and zero if
+// the location is unknown.
+type SpecParseError struct {
+	Path   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *SpecParseError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %v", e.Path, e.Err)
+	}
+	return fmt.Sprintf("%s:%d:%d: %v", e.Path, e.Line, e.Column, e.Err)
+}
+
+func (e *SpecParseError) Unwrap() error {
+	return e.Err
+}
+
+// readSpec reads the request spec file at path
+func readSpec(path string) ([]byte, error) {
+	if filepath.Ext(path) != ".json" {
+		return nil, &SpecParseError{Path: path, Err: errors.New("invalid file format, expected a JSON file")}
+	}
+
+	spec, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &SpecNotFoundError{Path: path}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read request spec: %w", err)
+	}
+	return spec, nil
+}
+
+// newSpecParseError locates a JSON decoding error in the spec it came from
+func newSpecParseError(path string, spec []byte, err error) *SpecParseError {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return &SpecParseError{Path: path, Err: err}
+	}
+
+	if offset > int64(len(spec)) {
+		offset = int64(len(spec))
+	}
+	before := spec[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - (bytes.LastIndexByte(before, '\n') + 1)
+	if column == 0 {
+		column = 1
+	}
+	return &SpecParseError{Path: path, Line: line, Column: column, Err: err}
+}
+
+// InvalidRequestError is a request of the spec that can't be sent. Index is
+// its position in the spec, starting at zero.
+type InvalidRequestError struct {
+	Index  int
+	Verb   string
+	URL    string
+	Reason string
+}
+
+func (e *InvalidRequestError) Error() string {
+	target := strings.TrimSpace(e.Verb + " " + e.URL)
+	if target == "" {
+		return fmt.Sprintf("request %d: %s", e.Index, e.Reason)
+	}
+	return fmt.Sprintf("request %d (%s): %s", e.Index, target, e.Reason)
+}
+
+// NoValidRequestsError is returned when every request of the spec is invalid
+type NoValidRequestsError struct {
+	Invalid []*InvalidRequestError
+}
+
+func (e *NoValidRequestsError) Error() string {
+	if len(e.Invalid) == 0 {
+		return "the request spec has no requests"
+	}
+	return fmt.Sprintf("none of the %d requests in the spec are valid", len(e.Invalid))
+}
+
+func newInvalidRequestError(req *Request, reason error) *InvalidRequestError {
+	err := &InvalidRequestError{
+		Index:  req.specIndex,
+		Verb:   req.Verb,
+		URL:    req.URL,
+		Reason: reason.Error(),
+	}
+	if req.URL == "" && req.Method != "" {
+		err.URL = req.Method
+	}
+	return err
+}
+
+// invalidRequest records why a request is left out of the test
+func (r *Runner) invalidRequest(req *Request, reason error) {
+	err := newInvalidRequestError(req, reason)
+	r.logf("Error: %v\n", err)
+	r.invalid = append(r.invalid, err)
+}
+
+// Invalid returns the requests left out of the test so far
+func (r *Runner) Invalid() []*InvalidRequestError {
+	return r.invalid
+}
@@ -0,0 +1,269 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// stream formats
+const (
+	StreamAuto   = ""       // picked from the Content-Type of the response
+	StreamSSE    = "sse"    // Server-Sent Events, text/event-stream
+	StreamNDJSON = "ndjson" // one event per line
+)
+
+// Stream holds a response open to count the events streamed over it
+type Stream struct {
+	Format   string `json:"format"`   // one of the Stream constants
+	Duration string `json:"duration"` // how long to hold the stream, e.g. "10s"
+	Events   int    `json:"events"`   // how many events to wait for
+
+	duration time.Duration
+}
+
+// prepareStream checks the stream options of a request
+func (req *Request) prepareStream() error {
+	s := req.Stream
+	switch s.Format {
+	case StreamAuto, StreamSSE, StreamNDJSON:
+	default:
+		return fmt.Errorf("unknown stream format: %s, expected sse or ndjson", s.Format)
+	}
+	if s.Duration != "" {
+		d, err := time.ParseDuration(s.Duration)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid stream duration: %s", s.Duration)
+		}
+		s.duration = d
+	}
+	if s.Events < 0 {
+		return fmt.Errorf("invalid stream event count: %d", s.Events)
+	}
+	if req.Verb != "GET" && req.Verb != "POST" {
+		return fmt.Errorf("verb: %s not allowed for streams", req.Verb)
+	}
+
+	if s.Format == StreamSSE {
+		if _, ok := req.header("Accept"); !ok {
+			if req.Headers == nil {
+				req.Headers = make(map[string]string)
+			}
+			req.Headers["Accept"] = "text/event-stream"
+		}
+	}
+	return nil
+}
+
+// open tells if a stream is read until the server ends it
+func (s *Stream) open() bool {
+	return s.duration == 0 && s.Events == 0
+}
+
+// eventScanner splits a streamed body into events
+type eventScanner struct {
+	r       *bufio.Reader
+	sse     bool
+	pending bool // SSE data lines seen since the last event
+}
+
+// next blocks until the next event has arrived
+func (s *eventScanner) next() error {
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if !s.sse {
+			if line != "" {
+				return nil
+			}
+			continue
+		}
+
+		// an SSE event is dispatched by the blank line after its data
+		switch {
+		case line == "":
+			if s.pending {
+				s.pending = false
+				return nil
+			}
+		case line == "data" || strings.HasPrefix(line, "data:"):
+			s.pending = true
+		}
+	}
+}
+
+// streamExecutor holds streaming responses open to count their events. A
+// stream counts as a single request and response, with the time to its first
+// event and the gaps between events counted apart.
+type streamExecutor struct {
+	t        *transports
+	protocol string        // one of the Protocol constants
+	timeout  time.Duration // of requests without one of their own
+}
+
+func (e *streamExecutor) session() {}
+
+func (e *streamExecutor) Prepare(req *Request) error {
+	if err := checkProtocol(e.protocol, req); err != nil {
+		return err
+	}
+	if isGraphQL(req) {
+		return fmt.Errorf("GraphQL requests can't be streamed, leave out stream")
+	}
+	if err := req.prepareStream(); err != nil {
+		return err
+	}
+	return req.prepareBody()
+}
+
+// Execute opens a streaming response and reads events off it until the
+// stream has been held long enough, the expected events arrived or the
+// server ended it
+func (e *streamExecutor) Execute(ctx context.Context, request *Request) Result {
+	s := request.Stream
+	rec := recorderFrom(ctx)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the timeout applies to the response headers and to every gap between
+	// events, the stream itself can be held for longer
+	var timedOut, held int32
+	timeout := request.timeoutOr(e.timeout)
+	var idle *time.Timer
+	if timeout > 0 {
+		idle = time.AfterFunc(timeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			cancel()
+		})
+		defer idle.Stop()
+	}
+	if s.duration > 0 {
+		hold := time.AfterFunc(s.duration, func() {
+			atomic.StoreInt32(&held, 1)
+			cancel()
+		})
+		defer hold.Stop()
+	}
+
+	req, err := newHTTPRequest(ctx, request)
+	if err != nil {
+		return Result{Err: err}
+	}
+
+	startTime := time.Now()
+	sent := requestSize(req)
+	rec.request(sent)
+
+	resp, err := e.t.http.Do(req)
+	if err != nil {
+		return Result{BytesSent: sent, Err: streamError(0, err, atomic.LoadInt32(&timedOut) == 1)}
+	}
+	defer resp.Body.Close()
+	if err = checkResponseProto(e.protocol, resp); err != nil {
+		return Result{BytesSent: sent, Err: err}
+	}
+
+	response := Response{
+		StatusCode:   resp.StatusCode,
+		ResponseTime: time.Since(startTime).Milliseconds(),
+		Timestamp:    startTime.UnixNano(),
+		Proto:        resp.Proto,
+	}
+	result := Result{
+		Status:    resp.StatusCode,
+		Latency:   time.Since(startTime),
+		Proto:     resp.Proto,
+		BytesSent: sent,
+	}
+
+	received := &countingWriter{}
+	reader := io.TeeReader(resp.Body, received)
+
+	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
+		response.Body = readErrorBody(reader)
+		response.BytesReceived = responseHeaderSize(resp) + received.n
+		rec.response(response)
+
+		result.Failed = true
+		result.Body = response.Body
+		result.BytesReceived = response.BytesReceived
+		return result
+	}
+
+	sse := s.Format == StreamSSE
+	if s.Format == StreamAuto {
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		sse = mediaType == "text/event-stream"
+	}
+	scanner := &eventScanner{r: bufio.NewReader(reader), sse: sse}
+
+	events := 0
+	last := startTime
+	for s.Events == 0 || events < s.Events {
+		if err = scanner.next(); err != nil {
+			break
+		}
+
+		now := time.Now()
+		if idle != nil {
+			idle.Reset(timeout)
+		}
+		rec.event(events == 0, now.Sub(last))
+		last = now
+		events++
+	}
+
+	response.BytesReceived = responseHeaderSize(resp) + received.n
+	result.BytesReceived = response.BytesReceived
+
+	switch {
+	case err == nil, atomic.LoadInt32(&held) == 1, err == io.EOF && s.open():
+		rec.response(response)
+	case err == io.EOF:
+		result.Err = &droppedError{events, fmt.Errorf("stream ended after %d events", events)}
+	default:
+		result.Err = streamError(events, err, atomic.LoadInt32(&timedOut) == 1)
+	}
+	return result
+}
+
+func (e *streamExecutor) Close() error {
+	e.t.http.CloseIdleConnections()
+	return nil
+}
+
+// streamError tells why a stream broke off after events
+func streamError(events int, err error, timedOut bool) error {
+	switch {
+	case timedOut:
+		return fmt.Errorf("no event within the timeout: %w", context.DeadlineExceeded)
+	case events > 0:
+		return &droppedError{events, err}
+	}
+	return err
+}
+
+func (w *shardWindow) recordFirstEvent(ms uint64) {
+	atomic.AddUint64(&w.events, 1)
+	w.firstEvent.record(ms)
+}
+
+func (w *shardWindow) recordEventGap(ms uint64) {
+	atomic.AddUint64(&w.events, 1)
+	w.eventGaps.record(ms)
+}
+
+func (w *shardWindow) recordStreamDrop() {
+	atomic.AddUint64(&w.errors, 1)
+	atomic.AddUint64(&w.streamDrops, 1)
+}
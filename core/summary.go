@@ -0,0 +1,222 @@
+package core
+
+import (
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Summary holds the aggregated results of a load test, warm-up excluded
+type Summary struct {
+	Duration      time.Duration
+	Requests      uint64
+	Responses     uint64
+	Errors        uint64
+	Timeouts      uint64
+	NetworkErrors [NumErrorCategories]uint64 // by ErrorCategory
+	ResponseTimes ResponseTimeStats
+	BytesSent     uint64
+	BytesReceived uint64
+	Endpoints     []EndpointSummary
+	Protocols     []ProtocolSummary // only protocols that got responses
+	WebSocket     WebSocketSummary
+	StatusCodes   []StatusCount // HTTP status codes, then gRPC ones
+	Operations    []OperationSummary
+	Streams       StreamSummary
+}
+
+// StreamSummary holds the events of streamed responses
+type StreamSummary struct {
+	Streams     uint64 // streams opened
+	Dropped     uint64 // streams that ended early
+	Events      uint64
+	FirstEvent  ResponseTimeStats // time from sending the request to the first event
+	FirstP50    uint64
+	FirstP99    uint64
+	EventGaps   ResponseTimeStats // time between consecutive events
+	EventGapP50 uint64
+	EventGapP99 uint64
+}
+
+// OperationSummary holds the GraphQL requests sharing an operation name
+type OperationSummary struct {
+	Name          string
+	Requests      uint64
+	Responses     uint64
+	Errors        uint64 // failed requests and responses with GraphQL errors
+	ResponseTimes ResponseTimeStats
+	P50           uint64
+	P90           uint64
+	P99           uint64
+}
+
+// StatusCount is how many responses came back with a status
+type StatusCount struct {
+	Status string // e.g. 200 or gRPC Unavailable
+	Count  uint64
+}
+
+// WebSocketSummary holds the connections and messages of WebSocket requests
+type WebSocketSummary struct {
+	Connections      uint64
+	Dropped          uint64
+	ConnectTimes     ResponseTimeStats
+	ConnectP50       uint64
+	ConnectP99       uint64
+	MessagesSent     uint64
+	MessagesReceived uint64
+}
+
+// ProtocolSummary holds the responses received over a single protocol
+type ProtocolSummary struct {
+	Protocol      string
+	Responses     uint64
+	BytesReceived uint64
+	ResponseTimes ResponseTimeStats
+	P50           uint64
+	P90           uint64
+	P99           uint64
+}
+
+// EndpointSummary holds the traffic of a single spec request
+type EndpointSummary struct {
+	Verb          string
+	URL           string
+	Requests      uint64
+	Responses     uint64
+	BytesSent     uint64
+	BytesReceived uint64
+}
+
+// AverageSent returns the average request size in bytes
+func (e EndpointSummary) AverageSent() uint64 {
+	if e.Requests == 0 {
+		return 0
+	}
+	return e.BytesSent / e.Requests
+}
+
+// AverageReceived returns the average response size in bytes
+func (e EndpointSummary) AverageReceived() uint64 {
+	if e.Responses == 0 {
+		return 0
+	}
+	return e.BytesReceived / e.Responses
+}
+
+// Summary returns the totals collected so far. It is safe to call while
+// the test is still draining.
+func (r *Runner) Summary() Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	end := r.endTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	duration := end.Sub(r.warmupEnd)
+	if duration < 0 {
+		duration = 0
+	}
+
+	ws := WebSocketSummary{
+		Connections:      r.totals.connects,
+		Dropped:          r.totals.drops,
+		ConnectTimes:     responseTimeStats(&r.totals.connectTime),
+		ConnectP50:       r.totals.connectTime.Percentile(50),
+		ConnectP99:       r.totals.connectTime.Percentile(99),
+		MessagesReceived: r.totals.protocols[protoWebSocket].responses,
+	}
+
+	streams := StreamSummary{
+		Dropped:     r.totals.streamDrops,
+		Events:      r.totals.events,
+		FirstEvent:  responseTimeStats(&r.totals.firstEvent),
+		FirstP50:    r.totals.firstEvent.Percentile(50),
+		FirstP99:    r.totals.firstEvent.Percentile(99),
+		EventGaps:   responseTimeStats(&r.totals.eventGaps),
+		EventGapP50: r.totals.eventGaps.Percentile(50),
+		EventGapP99: r.totals.eventGaps.Percentile(99),
+	}
+
+	endpoints := make([]EndpointSummary, len(r.requests))
+	for i, req := range r.requests {
+		endpoints[i] = EndpointSummary{Verb: req.Verb, URL: req.URL}
+		if i < len(r.totals.endpoints) {
+			e := r.totals.endpoints[i]
+			endpoints[i].Requests = e.requests
+			endpoints[i].Responses = e.responses
+			endpoints[i].BytesSent = e.bytesSent
+			endpoints[i].BytesReceived = e.bytesReceived
+			if req.ws {
+				ws.MessagesSent += e.requests
+			}
+			if req.Stream != nil {
+				streams.Streams += e.requests
+			}
+		}
+	}
+
+	var protocols []ProtocolSummary
+	for i, p := range r.totals.protocols {
+		if p.responses == 0 {
+			continue
+		}
+		protocols = append(protocols, ProtocolSummary{
+			Protocol:      protocolNames[i],
+			Responses:     p.responses,
+			BytesReceived: p.bytesReceived,
+			ResponseTimes: responseTimeStats(&p.latency),
+			P50:           p.latency.Percentile(50),
+			P90:           p.latency.Percentile(90),
+			P99:           p.latency.Percentile(99),
+		})
+	}
+
+	var statuses []StatusCount
+	for code, n := range r.totals.httpStatuses {
+		if n > 0 {
+			statuses = append(statuses, StatusCount{Status: strconv.Itoa(code), Count: n})
+		}
+	}
+	for code, n := range r.totals.grpcStatuses {
+		if n > 0 {
+			statuses = append(statuses, StatusCount{Status: grpcStatusText(codes.Code(code)), Count: n})
+		}
+	}
+
+	operations := make([]OperationSummary, len(r.operations))
+	for i, name := range r.operations {
+		operations[i].Name = name
+		if i < len(r.totals.operations) {
+			o := &r.totals.operations[i]
+			operations[i].Requests = o.requests
+			operations[i].Responses = o.responses
+			operations[i].Errors = o.errors
+			operations[i].ResponseTimes = responseTimeStats(&o.latency)
+			operations[i].P50 = o.latency.Percentile(50)
+			operations[i].P90 = o.latency.Percentile(90)
+			operations[i].P99 = o.latency.Percentile(99)
+		}
+	}
+
+	return Summary{
+		Duration:      duration,
+		Requests:      r.totals.requests,
+		Responses:     r.totals.responses,
+		Errors:        r.totals.errors,
+		Timeouts:      r.totals.timeouts,
+		NetworkErrors: r.totals.networkErrors,
+		ResponseTimes: responseTimeStats(&r.totals.latency),
+		BytesSent:     r.totals.bytesSent,
+		BytesReceived: r.totals.bytesReceived,
+		Endpoints:     endpoints,
+		Protocols:     protocols,
+		WebSocket:     ws,
+		StatusCodes:   statuses,
+		Operations:    operations,
+		Streams:       streams,
+	}
+}
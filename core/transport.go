@@ -0,0 +1,278 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/http2"
+)
+
+// protocols a load test can be restricted to
+const (
+	ProtocolAuto  = ""      // HTTP/2 where the server offers it over TLS, HTTP/1.1 otherwise
+	ProtocolHTTP1 = "http1" // HTTP/1.1 only
+	ProtocolHTTP2 = "http2" // HTTP/2 negotiated with ALPN
+	ProtocolH2C   = "h2c"   // cleartext HTTP/2 with prior knowledge
+)
+
+// responses are counted per protocol they arrived over
+const (
+	protoHTTP10 = iota
+	protoHTTP11
+	protoHTTP2
+	protoWebSocket
+	protoGRPC
+	protoTCP
+	protoUDP
+	protoOther
+	numProtocols
+)
+
+var protocolNames = [numProtocols]string{"HTTP/1.0", "HTTP/1.1", "HTTP/2.0", "WebSocket", "gRPC", "TCP", "UDP", "other"}
+
+func protocolIndex(proto string) int {
+	for i, name := range protocolNames[:protoOther] {
+		if proto == name {
+			return i
+		}
+	}
+	return protoOther
+}
+
+// TLSConfig holds the TLS options applied to every HTTPS request
+type TLSConfig struct {
+	CACert     string   // PEM bundle replacing the system roots
+	Cert       string   // PEM client certificate
+	Key        string   // PEM client key, defaults to Cert
+	Insecure   bool     // skip certificate verification
+	ServerName string   // SNI and verification name override
+	MinVersion string   // 1.0, 1.1, 1.2 or 1.3
+	MaxVersion string   // 1.0, 1.1, 1.2 or 1.3
+	Ciphers    []string // cipher suite names, TLS 1.2 and below only
+}
+
+// isSet tells if any TLS option was given
+func (c TLSConfig) isSet() bool {
+	return c.CACert != "" || c.Cert != "" || c.Key != "" || c.Insecure || c.ServerName != "" ||
+		c.MinVersion != "" || c.MaxVersion != "" || len(c.Ciphers) > 0
+}
+
+// checkProtocol tells if a request can be sent with protocol, which only
+// speaks HTTP/2 over TLS or only in cleartext and without a proxy
+func checkProtocol(protocol string, req *Request) error {
+	switch scheme := urlScheme(req.target); {
+	case protocol == ProtocolHTTP2 && scheme == "http":
+		return fmt.Errorf("http2 is negotiated over TLS, use h2c for http:// urls")
+	case protocol == ProtocolH2C && scheme == "https":
+		return fmt.Errorf("h2c is cleartext, https:// urls can't be sent with it")
+	case protocol == ProtocolH2C && req.proxy != nil:
+		return fmt.Errorf("h2c can't be used through a proxy")
+	}
+	return nil
+}
+
+// checkResponseProto fails responses that didn't come over HTTP/2 when
+// protocol requires it, such as from servers that ignore ALPN
+func checkResponseProto(protocol string, resp *http.Response) error {
+	if protocol == ProtocolHTTP2 && resp.ProtoMajor != 2 {
+		return fmt.Errorf("expected HTTP/2, the server answered with %s", resp.Proto)
+	}
+	return nil
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	if v == "" {
+		return 0, nil
+	}
+	version, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(v), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", v)
+	}
+	return version, nil
+}
+
+func parseCiphers(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[s.Name] = s.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (c TLSConfig) build() (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: c.Insecure,
+		ServerName:         c.ServerName,
+	}
+
+	var err error
+	if cfg.MinVersion, err = parseTLSVersion(c.MinVersion); err != nil {
+		return nil, err
+	}
+	if cfg.MaxVersion, err = parseTLSVersion(c.MaxVersion); err != nil {
+		return nil, err
+	}
+	if cfg.CipherSuites, err = parseCiphers(c.Ciphers); err != nil {
+		return nil, err
+	}
+
+	if c.CACert != "" {
+		pem, err := os.ReadFile(c.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", c.CACert)
+		}
+	}
+
+	if c.Cert != "" {
+		key := c.Key
+		if key == "" {
+			key = c.Cert
+		}
+		cert, err := tls.LoadX509KeyPair(c.Cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	} else if c.Key != "" {
+		return nil, fmt.Errorf("a client key needs a client certificate")
+	}
+
+	return cfg, nil
+}
+
+// transports holds what the load test clients connect with. They are
+// shared so connections are reused across requests.
+type transports struct {
+	http *http.Client
+	ws   *websocket.Dialer
+	grpc grpcConns
+
+	tls    *tls.Config
+	dialer *dialer
+}
+
+// newTransports builds the transports of every request type. sockets maps
+// the made up hosts of unix socket URLs to their sockets.
+func newTransports(config Config, sockets map[string]string) (*transports, error) {
+	tlsConfig, err := config.TLS.build()
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := newDialer(config, sockets)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := proxyFunc(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &websocket.Dialer{
+		NetDialContext:  dialer.DialContext,
+		Proxy:           proxy,
+		TLSClientConfig: tlsConfig.Clone(),
+	}
+
+	// the HTTP client narrows down the protocols its config offers over
+	// ALPN, which gRPC connections must not inherit
+	httpClient, err := newHTTPClient(config, tlsConfig.Clone(), dialer, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transports{
+		http:   httpClient,
+		ws:     ws,
+		tls:    tlsConfig,
+		dialer: dialer,
+	}, nil
+}
+
+func newHTTPClient(
+	config Config,
+	tlsConfig *tls.Config,
+	dialer *dialer,
+	proxy func(*http.Request) (*url.URL, error),
+) (*http.Client, error) {
+	if config.Protocol == ProtocolH2C {
+		if config.Proxy != "" {
+			return nil, fmt.Errorf("h2c can't be used through a proxy")
+		}
+		if config.TLS.isSet() {
+			return nil, fmt.Errorf("h2c is cleartext, TLS options can't be used with it")
+		}
+		transport := &http2.Transport{
+			AllowHTTP:          true,
+			DisableCompression: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		}
+		return &http.Client{Transport: transport}, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = proxy
+	transport.TLSClientConfig = tlsConfig
+	// bodies are counted as they come over the wire, which they wouldn't be
+	// once the transport unzipped them
+	transport.DisableCompression = true
+	// keep a connection per client alive instead of redialling
+	transport.MaxIdleConns = 0
+	transport.MaxIdleConnsPerHost = config.NumClients
+	if transport.MaxIdleConnsPerHost < http.DefaultMaxIdleConnsPerHost {
+		transport.MaxIdleConnsPerHost = http.DefaultMaxIdleConnsPerHost
+	}
+
+	switch config.Protocol {
+	case ProtocolAuto:
+	case ProtocolHTTP1:
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		tlsConfig.NextProtos = []string{"http/1.1"}
+	case ProtocolHTTP2:
+		if _, err := http2.ConfigureTransports(transport); err != nil {
+			return nil, err
+		}
+		tlsConfig.NextProtos = []string{http2.NextProtoTLS}
+	default:
+		return nil, fmt.Errorf("unknown protocol %q", config.Protocol)
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
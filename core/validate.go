@@ -0,0 +1,199 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ValidateSpec checks the request spec at path without sending anything:
+// fields blitz doesn't know, URLs it can't send to and requests it would
+// leave out of a load test. Every problem is returned, in spec order. The
+// error is set if the spec can't be read or parsed at all.
+//
+// gRPC methods are looked up in their protoset, but not over server
+// reflection, as that needs the server.
+func ValidateSpec(path string) ([]*InvalidRequestError, error) {
+	spec, err := readSpec(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []json.RawMessage
+	if err = json.Unmarshal(spec, &raw); err != nil {
+		return nil, newSpecParseError(path, spec, err)
+	}
+	var requests []*Request
+	if err = json.Unmarshal(spec, &requests); err != nil {
+		return nil, newSpecParseError(path, spec, err)
+	}
+
+	r := &Runner{}
+	for i, req := range requests {
+		if req == nil {
+			r.problem(i, &Request{}, errors.New("empty request"))
+			continue
+		}
+
+		// preparing fills in defaults, problems are shown as written
+		written := &Request{Verb: req.Verb, URL: req.URL, Method: req.Method}
+
+		for _, field := range unknownFields(raw[i], reflect.TypeOf(Request{}), "") {
+			r.problem(i, written, fmt.Errorf("unknown field %q", field))
+		}
+
+		if err := checkURL(req); err != nil {
+			r.problem(i, written, err)
+			continue
+		}
+		if err := r.prepareRequest(req); err != nil {
+			r.problem(i, written, err)
+			continue
+		}
+		if registeredExecutor(requestScheme(req)) != nil {
+			continue
+		}
+		// the built-in executors prepare requests without transports
+		e := newBuiltInExecutor(builtInKind(req), Config{}, nil)
+		if e == nil {
+			continue
+		}
+		if err := e.Prepare(req); err != nil {
+			r.problem(i, written, err)
+			continue
+		}
+		if _, ok := e.(*grpcExecutor); ok && req.Protoset != "" {
+			if err := checkProtoset(req); err != nil {
+				r.problem(i, written, err)
+			}
+		}
+	}
+
+	sort.SliceStable(r.invalid, func(a, b int) bool { return r.invalid[a].Index < r.invalid[b].Index })
+	return r.invalid, nil
+}
+
+// checkProtoset looks the method of a gRPC request up in its protoset and
+// checks the messages it sends against it
+func checkProtoset(req *Request) error {
+	files, err := loadProtoset(req.Protoset)
+	if err != nil {
+		return err
+	}
+	_, err = newGRPCCall(files, req)
+	return err
+}
+
+// problem records a problem of the request at index without logging it
+func (r *Runner) problem(index int, req *Request, reason error) {
+	req.specIndex = index
+	r.invalid = append(r.invalid, newInvalidRequestError(req, reason))
+}
+
+// checkURL tells if the URL of a request can be sent to
+func checkURL(req *Request) error {
+	if isGRPC(req) && req.URL == "" {
+		return nil
+	}
+	if req.URL == "" {
+		return errors.New("missing url")
+	}
+
+	scheme := urlScheme(req.URL)
+	switch scheme {
+	case "":
+		return fmt.Errorf("url %q has no scheme such as http://", req.URL)
+	case "unix":
+		// checked by parseUnixURL
+		return nil
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+
+	switch scheme {
+	case "http", "https", "ws", "wss", "tcp", "udp":
+		if u.Host == "" {
+			return fmt.Errorf("url %q has no host", req.URL)
+		}
+	default:
+		if registeredExecutor(scheme) == nil {
+			return fmt.Errorf("no executor for url scheme %q", scheme)
+		}
+	}
+	return nil
+}
+
+// unknownFields returns the paths of the JSON fields in raw that don't map
+// to a field of t, matching names like encoding/json does
+func unknownFields(raw json.RawMessage, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(raw, &fields) != nil {
+			return nil
+		}
+
+		known := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := f.Name
+			if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			known[strings.ToLower(name)] = f.Type
+		}
+
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var unknown []string
+		for _, name := range names {
+			child := name
+			if path != "" {
+				child = path + "." + name
+			}
+			ft, ok := known[strings.ToLower(name)]
+			if !ok {
+				unknown = append(unknown, child)
+				continue
+			}
+			unknown = append(unknown, unknownFields(fields[name], ft, child)...)
+		}
+		return unknown
+
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		var items []json.RawMessage
+		if json.Unmarshal(raw, &items) != nil {
+			return nil
+		}
+		var unknown []string
+		for i, item := range items {
+			unknown = append(unknown, unknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return unknown
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateSpecUnknownFields(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want []string
+	}{
+		{
+			name: "known fields",
+			spec: `[{"verb": "GET", "url": "http://localhost/", "headers": {"X-Anything": "y"}, "timeout": "1s"}]`,
+		},
+		{
+			name: "names match case-insensitively",
+			spec: `[{"Verb": "GET", "URL": "http://localhost/", "TIMEOUT": "1s"}]`,
+		},
+		{
+			name: "body is free-form",
+			spec: `[{"verb": "POST", "url": "http://localhost/", "body": {"anything": [1, {"goes": true}]}}]`,
+		},
+		{
+			name: "typo",
+			spec: `[{"verb": "GET", "url": "http://localhost/", "header": {"X": "y"}}]`,
+			want: []string{`request 0 (GET http://localhost/): unknown field "header"`},
+		},
+		{
+			name: "content type of the sample spec",
+			spec: `[{"verb": "PUT", "url": "http://localhost:3333", "contentType": "application/json", "body": [{"k": "v"}]}]`,
+			want: []string{`request 0 (PUT http://localhost:3333): unknown field "contentType"`},
+		},
+		{
+			name: "encoded body",
+			spec: `[{"verb": "POST", "url": "http://localhost/", "bodyBytes": "aGk="}]`,
+			want: []string{`request 0 (POST http://localhost/): unknown field "bodyBytes"`},
+		},
+		{
+			name: "nested field",
+			spec: `[{"verb": "GET", "url": "http://localhost/", "stream": {"format": "sse", "Duraton": "1s"}}]`,
+			want: []string{`request 0 (GET http://localhost/): unknown field "stream.Duraton"`},
+		},
+		{
+			name: "field of a list item",
+			spec: `[{"url": "ws://localhost/", "messages": [{"data": "hi"}, {"data": "x", "dely": "1s"}]}]`,
+			want: []string{`request 0 (ws://localhost/): unknown field "messages[1].dely"`},
+		},
+		{
+			name: "every request and field",
+			spec: `[
+				{"verb": "GET", "url": "http://localhost/"},
+				{"url": "tcp://localhost:7", "payload": {"text": "ping"}, "reply": {"delimiter": "\n", "lenght": 4}, "retries": 3}
+			]`,
+			want: []string{
+				`request 1 (tcp://localhost:7): unknown field "reply.lenght"`,
+				`request 1 (tcp://localhost:7): unknown field "retries"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "spec.json")
+			if err := os.WriteFile(path, []byte(tt.spec), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			problems, err := ValidateSpec(path)
+			if err != nil {
+				t.Fatalf("ValidateSpec: %v", err)
+			}
+			var got []string
+			for _, p := range problems {
+				got = append(got, p.Error())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateSpec problems = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
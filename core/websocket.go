@@ -0,0 +1,188 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Message is one step of a WebSocket script or gRPC stream
+type Message struct {
+	Data    interface{} `json:"data"`    // sent as is if it is a string, as JSON otherwise
+	Delay   string      `json:"delay"`   // wait before sending, e.g. "500ms"
+	NoReply bool        `json:"noReply"` // don't wait for a reply
+
+	bytes []byte
+	delay time.Duration
+}
+
+func isWebSocketURL(url string) bool {
+	return strings.HasPrefix(url, "ws://") || strings.HasPrefix(url, "wss://")
+}
+
+// prepareWebSocket checks a WebSocket request and encodes its messages
+func (req *Request) prepareWebSocket() error {
+	switch req.Verb {
+	case "":
+		req.Verb = "WS"
+	case "WS", "GET":
+	default:
+		return fmt.Errorf("verb: %s not allowed for WebSockets", req.Verb)
+	}
+
+	if err := req.prepareMessages(); err != nil {
+		return err
+	}
+
+	req.ws = true
+	return nil
+}
+
+// prepareMessages encodes the data and parses the delay of every message
+func (req *Request) prepareMessages() error {
+	for i := range req.Messages {
+		m := &req.Messages[i]
+
+		if s, ok := m.Data.(string); ok {
+			m.bytes = []byte(s)
+		} else {
+			b, err := json.Marshal(m.Data)
+			if err != nil {
+				return fmt.Errorf("could not encode message %d: %w", i, err)
+			}
+			m.bytes = b
+		}
+
+		if m.Delay != "" {
+			d, err := time.ParseDuration(m.Delay)
+			if err != nil || d < 0 {
+				return fmt.Errorf("invalid delay: %s for message %d", m.Delay, i)
+			}
+			m.delay = d
+		}
+	}
+
+	return nil
+}
+
+// wsExecutor plays the message script of ws:// and wss:// requests. Every
+// message is counted as a request and every reply as a response, so the
+// round trip time shows up as the response time.
+type wsExecutor struct {
+	t       *transports
+	timeout time.Duration // of requests without one of their own
+}
+
+func (e *wsExecutor) session() {}
+
+func (e *wsExecutor) Prepare(req *Request) error {
+	return req.prepareWebSocket()
+}
+
+// Execute opens a connection, plays the message script over it and closes it
+func (e *wsExecutor) Execute(ctx context.Context, request *Request) Result {
+	rec := recorderFrom(ctx)
+	timeout := request.timeoutOr(e.timeout)
+
+	header := http.Header{}
+	for k, v := range request.Headers {
+		header.Set(k, v)
+	}
+
+	dialCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	startTime := time.Now()
+	conn, resp, err := e.t.ws.DialContext(dialCtx, request.URL, header)
+	if err != nil {
+		if errors.Is(err, websocket.ErrBadHandshake) && resp != nil {
+			return Result{
+				Status: resp.StatusCode,
+				Failed: true,
+				Proto:  resp.Proto,
+				Body:   readErrorBody(resp.Body),
+			}
+		}
+		return Result{Err: err}
+	}
+	defer conn.Close()
+	rec.connect(time.Since(startTime))
+
+	// in-flight sessions are cut short once the grace period is over
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	var sent, received uint64
+	for i, m := range request.Messages {
+		if m.delay > 0 {
+			select {
+			case <-time.After(m.delay):
+			case <-ctx.Done():
+				return Result{Err: ctx.Err()}
+			}
+		}
+
+		sentAt := time.Now()
+		if err := conn.WriteMessage(websocket.TextMessage, m.bytes); err != nil {
+			return Result{Err: &droppedError{i, err}}
+		}
+		sent += uint64(len(m.bytes))
+		rec.request(uint64(len(m.bytes)))
+
+		if m.NoReply {
+			continue
+		}
+
+		if timeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+		_, reply, err := conn.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return Result{Err: fmt.Errorf("no reply to message %d: %w", i, context.DeadlineExceeded)}
+			}
+			return Result{Err: &droppedError{i, err}}
+		}
+		received += uint64(len(reply))
+
+		rec.response(Response{
+			ResponseTime:  time.Since(sentAt).Milliseconds(),
+			Timestamp:     sentAt.UnixNano(),
+			Proto:         protocolNames[protoWebSocket],
+			BytesReceived: uint64(len(reply)),
+		})
+	}
+
+	closing := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	conn.WriteControl(websocket.CloseMessage, closing, time.Now().Add(time.Second))
+
+	return Result{
+		Latency:       time.Since(startTime),
+		Proto:         protocolNames[protoWebSocket],
+		BytesSent:     sent,
+		BytesReceived: received,
+	}
+}
+
+func (e *wsExecutor) Close() error {
+	return nil
+}
@@ -2,12 +2,9 @@ package main
 
 import (
 	"github.com/startswithzed/blitz/cmd"
-	"log"
+	"os"
 )
 
 func main() {
-	rootCmd := cmd.GetRootCmd()
-	if err := rootCmd.Execute(); err != nil {
-		log.Fatal(err)
-	}
+	os.Exit(cmd.Execute())
 }
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/startswithzed/blitz/core"
-	"log"
 	"strconv"
 	"sync"
 	"time"
@@ -13,58 +12,79 @@ import (
 	"github.com/gizak/termui/v3/widgets"
 )
 
+// Controller lets the dashboard steer a running load test
+type Controller interface {
+	Pause()
+	Resume()
+	Paused() bool
+	AddClients(n int)
+	RemoveClients(n int)
+	NumClients() int
+	SetTargetRPS(rps uint64)
+	TargetRPS() uint64
+}
+
 type Dashboard struct {
 	testDuration   time.Duration
+	warmup         time.Duration
 	durationTicker *time.Ticker
-	outputs        *[]ui.Drawable
+	grid           *ui.Grid
+	graphs         []*lineGraph
 	uiMutex        sync.Mutex
 	cancel         context.CancelFunc
+	stop           <-chan struct{}
+	control        Controller
+	controls       *widgets.Paragraph
+	errorLog       *errorLog
 
 	// refresh channel
 	RefreshReqChan chan struct{}
 
+	// widgets fed by the snapshots
+	percentiles  *lineGraph
+	reqPSGraph   *lineGraph
+	resPSGraph   *lineGraph
+	throughput   *lineGraph
+	distribution *widgets.BarChart
+	breakdown    *widgets.Paragraph
+	stats        *widgets.Table
+
 	// data channels
-	reqPS        <-chan uint64
-	resPS        <-chan uint64
-	resTimes     <-chan uint64
-	resStats     <-chan core.ResponseTimeStats
-	errorStream  <-chan interface{}
-	errCountChan <-chan uint64
+	snapshots   <-chan core.Snapshot
+	errorStream <-chan interface{}
 }
 
-type widgetPosition struct {
-	x1 int
-	x2 int
-	y1 int
-	y2 int
+// lineGraph keeps more history than fits on screen so the plot can grow
+// and shrink with the terminal
+type lineGraph struct {
+	plot    *widgets.Plot
+	history [][]float64 // one per line
 }
 
 type DashboardConfig struct {
 	Duration    time.Duration
+	Warmup      time.Duration
 	Ticker      *time.Ticker
 	Cancel      context.CancelFunc
-	ReqPS       <-chan uint64
-	ResPS       <-chan uint64
-	ResTimes    <-chan uint64
-	ResStats    <-chan core.ResponseTimeStats
+	Stop        <-chan struct{}
+	Control     Controller
+	Snapshots   <-chan core.Snapshot
 	ErrorStream <-chan interface{}
-	ErrorCount  <-chan uint64
 }
 
 func NewDashboard(dc DashboardConfig) *Dashboard {
 	return &Dashboard{
-		testDuration:   dc.Duration,
+		testDuration:   dc.Warmup + dc.Duration,
+		warmup:         dc.Warmup,
 		durationTicker: dc.Ticker,
-		outputs:        &[]ui.Drawable{},
+		grid:           ui.NewGrid(),
 		uiMutex:        sync.Mutex{},
 		cancel:         dc.Cancel,
+		stop:           dc.Stop,
+		control:        dc.Control,
 		RefreshReqChan: make(chan struct{}, 1),
-		reqPS:          dc.ReqPS,
-		resPS:          dc.ResPS,
-		resTimes:       dc.ResTimes,
-		resStats:       dc.ResStats,
+		snapshots:      dc.Snapshots,
 		errorStream:    dc.ErrorStream,
-		errCountChan:   dc.ErrorCount,
 	}
 }
 
@@ -75,38 +95,11 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
 }
 
-func logsToString(logs []interface{}) string {
-	str := ""
-	for _, errLog := range logs {
-		switch l := errLog.(type) {
-		case core.ResponseError:
-			str += fmt.Sprintf("%d  [%d](fg:red)  %s  [%s](fg:blue)\n", l.Timestamp, l.StatusCode, l.Verb, l.URL)
-		case core.NetworkError:
-			str += fmt.Sprintf("%d  [%s](fg:red)\n", l.Timestamp, l.Error)
-		default:
-		}
+func warmupTag(warmup bool) string {
+	if warmup {
+		return "[warm-up](fg:yellow)  "
 	}
-
-	return str
-}
-
-func uint64ToFloat64Chan(in <-chan uint64) <-chan float64 {
-	out := make(chan float64)
-
-	go func() {
-		for {
-			select {
-			case val, ok := <-in:
-				if !ok {
-					close(out)
-					return
-				}
-				out <- float64(val)
-			}
-		}
-	}()
-
-	return out
+	return ""
 }
 
 func (d *Dashboard) refreshUI() {
@@ -114,7 +107,7 @@ func (d *Dashboard) refreshUI() {
 	defer d.uiMutex.Unlock()
 
 	ui.Clear()
-	ui.Render(*d.outputs...)
+	ui.Render(d.grid)
 }
 
 func (d *Dashboard) launchRefreshWorker() {
@@ -131,35 +124,135 @@ func (d *Dashboard) launchRefreshWorker() {
 	}()
 }
 
-func (d *Dashboard) drawLineGraph(title string, pos widgetPosition, dataChan <-chan float64) {
-	const MarkingsBuffer = 7
-	lengthXAxis := pos.x2 - pos.x1 - MarkingsBuffer
-
-	dataArr := make([][]float64, 1)
-	dataArr[0] = make([]float64, lengthXAxis)
-	var data []float64
-
+func (d *Dashboard) newLineGraph(title string, colors ...ui.Color) *lineGraph {
 	p := widgets.NewPlot()
 	p.Title = title
-	p.Data = dataArr
-	p.SetRect(pos.x1, pos.y1, pos.x2, pos.y2)
-	p.LineColors[0] = ui.ColorYellow
+	p.Data = make([][]float64, len(colors))
+	p.LineColors = colors
 	p.DrawDirection = widgets.DrawRight
 
-	*d.outputs = append(*d.outputs, p)
+	g := &lineGraph{
+		plot:    p,
+		history: make([][]float64, len(colors)),
+	}
+	g.fit()
+	d.graphs = append(d.graphs, g)
 
+	return g
+}
+
+// push adds the next value of every line. It must be called with the ui
+// mutex held.
+func (g *lineGraph) push(vals ...float64) {
+	const MaxHistory = 1000
+
+	for i, val := range vals {
+		g.history[i] = append(g.history[i], val)
+		if len(g.history[i]) > MaxHistory {
+			g.history[i] = g.history[i][1:]
+		}
+	}
+	g.fit()
+}
+
+// fit shows as much of the history as the plot is wide. It must be called
+// with the ui mutex held.
+func (g *lineGraph) fit() {
+	const MarkingsBuffer = 5 // room for the y axis labels
+	lengthXAxis := g.plot.Inner.Dx() - MarkingsBuffer
+	if lengthXAxis < 2 {
+		lengthXAxis = 2
+	}
+
+	for i, data := range g.history {
+		if len(data) > lengthXAxis {
+			data = data[len(data)-lengthXAxis:]
+		}
+
+		points := make([]float64, lengthXAxis)
+		copy(points, data)
+		g.plot.Data[i] = points
+	}
+}
+
+func distributionLabels() []string {
+	labels := make([]string, 0, len(core.LatencyBuckets)+1)
+	for _, bound := range core.LatencyBuckets {
+		labels = append(labels, "<"+strconv.FormatUint(bound, 10))
+	}
+	last := core.LatencyBuckets[len(core.LatencyBuckets)-1]
+	return append(labels, "≥"+strconv.FormatUint(last, 10))
+}
+
+// fitBars spreads the distribution bars over the chart width. It must be
+// called with the ui mutex held.
+func fitBars(b *widgets.BarChart) {
+	const MinBarWidth = 3
+
+	width := b.Inner.Dx()/len(b.Labels) - b.BarGap
+	if width < MinBarWidth {
+		width = MinBarWidth
+	}
+	b.BarWidth = width
+}
+
+func (d *Dashboard) drawDistribution(title string) ui.Drawable {
+	b := widgets.NewBarChart()
+	b.Title = title
+	b.Labels = distributionLabels()
+	b.Data = make([]float64, len(b.Labels))
+	b.BarColors = []ui.Color{ui.ColorGreen}
+	b.NumStyles = []ui.Style{ui.NewStyle(ui.ColorBlack)}
+	b.NumFormatter = func(n float64) string { return strconv.FormatFloat(n, 'f', 0, 64) }
+	b.MaxVal = 1 // termui can't scale bars that are all zero
+
+	d.distribution = b
+
+	return b
+}
+
+func (d *Dashboard) drawBreakdown(title string) ui.Drawable {
+	p := widgets.NewParagraph()
+	p.Title = title
+	p.Text = breakdownText([core.NumErrorCategories]uint64{})
+
+	d.breakdown = p
+
+	return p
+}
+
+// breakdownText lays the network error counts out in two columns
+func breakdownText(counts [core.NumErrorCategories]uint64) string {
+	const Columns = 2
+
+	text := ""
+	for i, n := range counts {
+		cell := fmt.Sprintf("%-15s %6s", core.ErrorCategory(i), formatCount(n))
+		if n > 0 {
+			cell = fmt.Sprintf("[%s](fg:red)", cell)
+		}
+		text += cell
+		if (i+1)%Columns == 0 {
+			text += "\n"
+		} else {
+			text += "  "
+		}
+	}
+	return text
+}
+
+// watchSnapshots updates every snapshot fed widget once per snapshot
+func (d *Dashboard) watchSnapshots() {
 	go func() {
 		for {
 			select {
-			case val, ok := <-dataChan:
+			case snapshot, ok := <-d.snapshots:
 				if !ok {
 					return
 				}
-				data = append(data, val)
-				if len(data) > lengthXAxis {
-					data = data[1:]
-				}
-				copy(dataArr[0][:], data)
+				d.uiMutex.Lock()
+				d.showSnapshot(snapshot)
+				d.uiMutex.Unlock()
 				select {
 				case d.RefreshReqChan <- struct{}{}:
 				default:
@@ -169,19 +262,43 @@ func (d *Dashboard) drawLineGraph(title string, pos widgetPosition, dataChan <-c
 	}()
 }
 
-func (d *Dashboard) drawGauge(title string, pos widgetPosition) {
+// showSnapshot must be called with the ui mutex held
+func (d *Dashboard) showSnapshot(snapshot core.Snapshot) {
+	d.reqPSGraph.push(float64(snapshot.ReqPS))
+	d.resPSGraph.push(float64(snapshot.ResPS))
+	d.throughput.push(float64(snapshot.SentPS)/1024, float64(snapshot.ReceivedPS)/1024)
+
+	latency := snapshot.Latency
+	d.percentiles.push(float64(latency.P50), float64(latency.P90), float64(latency.P99))
+
+	d.distribution.MaxVal = 1
+	for i, c := range latency.Distribution {
+		d.distribution.Data[i] = float64(c)
+		if c > 0 {
+			d.distribution.MaxVal = 0
+		}
+	}
+
+	stats := snapshot.ResponseTimes
+	d.stats.Rows[1][0] = strconv.FormatUint(stats.AverageTime, 10)
+	d.stats.Rows[1][1] = strconv.FormatUint(stats.MaxTime, 10)
+	d.stats.Rows[1][2] = strconv.FormatUint(stats.MinTime, 10)
+	d.stats.Rows[1][3] = strconv.FormatUint(snapshot.Errors, 10)
+	d.stats.Rows[1][4] = strconv.FormatUint(snapshot.Timeouts, 10)
+
+	d.breakdown.Text = breakdownText(snapshot.NetworkErrors)
+}
+
+func (d *Dashboard) drawGauge(title string) ui.Drawable {
 	startTime := time.Now()
 	endTime := startTime.Add(d.testDuration)
 
 	g := widgets.NewGauge()
 	g.Title = title
-	g.SetRect(pos.x1, pos.y1, pos.x2, pos.y2)
 	g.BarColor = ui.ColorGreen
 	g.TitleStyle.Fg = ui.ColorCyan
 	g.Percent = 0
 
-	*d.outputs = append(*d.outputs, g)
-
 	go func() {
 		percent := 0
 		for {
@@ -201,6 +318,12 @@ func (d *Dashboard) drawGauge(title string, pos widgetPosition) {
 
 				g.Percent = percent
 				g.Label = fmt.Sprintf("%v%% %v/%v", g.Percent, formatDuration(elapsed), formatDuration(d.testDuration))
+				if elapsed < d.warmup {
+					g.BarColor = ui.ColorYellow
+					g.Label = "warm-up " + g.Label
+				} else {
+					g.BarColor = ui.ColorGreen
+				}
 				select {
 				case d.RefreshReqChan <- struct{}{}:
 				default:
@@ -208,9 +331,11 @@ func (d *Dashboard) drawGauge(title string, pos widgetPosition) {
 			}
 		}
 	}()
+
+	return g
 }
 
-func (d *Dashboard) drawTable(title string, pos widgetPosition) {
+func (d *Dashboard) drawTable(title string) ui.Drawable {
 	t := widgets.NewTable()
 	t.Title = title
 	t.Rows = [][]string{
@@ -219,157 +344,215 @@ func (d *Dashboard) drawTable(title string, pos widgetPosition) {
 			"Max Response Time",
 			"Min Response Time",
 			"Error Count",
+			"Timeouts",
 		},
 		{
 			"0",
 			"0",
 			"0",
 			"0",
+			"0",
 		},
 	}
 	t.RowSeparator = true
-	t.SetRect(pos.x1, pos.y1, pos.x2, pos.y2)
 	t.RowStyles[0] = ui.NewStyle(ui.ColorWhite, ui.ColorClear, ui.ModifierBold)
 	t.TextAlignment = ui.AlignCenter
 
-	*d.outputs = append(*d.outputs, t)
+	d.stats = t
+
+	return t
+}
+
+func (d *Dashboard) drawLogs(title string) ui.Drawable {
+	d.errorLog = newErrorLog(title)
 
 	go func() {
 		for {
 			select {
-			case c, ok := <-d.errCountChan:
-				if !ok {
-					return
-				}
-				t.Rows[1][3] = strconv.FormatUint(c, 10)
-				select {
-				case d.RefreshReqChan <- struct{}{}:
-				default:
-				}
-			case stats, ok := <-d.resStats:
+			case val, ok := <-d.errorStream:
 				if !ok {
 					return
 				}
-				t.Rows[1][0] = strconv.FormatUint(stats.AverageTime, 10)
-				t.Rows[1][1] = strconv.FormatUint(stats.MaxTime, 10)
-				t.Rows[1][2] = strconv.FormatUint(stats.MinTime, 10)
+				d.uiMutex.Lock()
+				d.errorLog.add(val)
+				d.uiMutex.Unlock()
 				select {
 				case d.RefreshReqChan <- struct{}{}:
 				default:
 				}
-			default:
 			}
 		}
 	}()
+
+	return d.errorLog
 }
 
-func (d *Dashboard) drawLogs(title string, pos widgetPosition) {
-	logs := make([]interface{}, 11)
+func (d *Dashboard) controlsToString() string {
+	state := "[running](fg:green)"
+	if d.control.Paused() {
+		state = "[paused](fg:yellow)"
+	}
+
+	rps := "unlimited"
+	if target := d.control.TargetRPS(); target > 0 {
+		rps = strconv.FormatUint(target, 10)
+	}
+
+	return fmt.Sprintf("state: %s  clients: %d  target rps: %s\n", state, d.control.NumClients(), rps) +
+		"[p](fg:cyan) pause/resume  [+/-](fg:cyan) clients  [</>](fg:cyan) target rps  [u](fg:cyan) unlimited  [q](fg:cyan) quit"
+}
 
+func (d *Dashboard) drawControls(title string) ui.Drawable {
 	p := widgets.NewParagraph()
 	p.Title = title
-	p.Text = logsToString(logs)
-	p.SetRect(pos.x1, pos.y1, pos.x2, pos.y2)
+	p.Text = d.controlsToString()
 
-	*d.outputs = append(*d.outputs, p)
+	d.controls = p
 
-	go func() {
-		for {
-			select {
-			case val, ok := <-d.errorStream:
-				if !ok {
-					return
-				}
-				switch l := val.(type) {
-				case core.ResponseError, core.NetworkError:
-					logs = append(logs, l)
-					if len(logs) > 10 {
-						logs = logs[1:]
-					}
-					p.Text = logsToString(logs)
-					select {
-					case d.RefreshReqChan <- struct{}{}:
-					default:
-					}
-				default:
-				}
-			}
-		}
-	}()
+	return p
 }
 
-func (d *Dashboard) DrawDashboard() {
-	if err := ui.Init(); err != nil {
-		log.Fatalf("failed to initialize termui: %v", err)
+// handleControl applies a control key press and reports whether it was one
+func (d *Dashboard) handleControl(key string) bool {
+	const RPSStep = 10
+
+	switch key {
+	case "p":
+		if d.control.Paused() {
+			d.control.Resume()
+		} else {
+			d.control.Pause()
+		}
+	case "+", "=":
+		d.control.AddClients(1)
+	case "-":
+		d.control.RemoveClients(1)
+	case ">":
+		d.control.SetTargetRPS(d.control.TargetRPS() + RPSStep)
+	case "<":
+		// never below a step, lifting the cap is a key of its own
+		if target := d.control.TargetRPS(); target > RPSStep {
+			d.control.SetTargetRPS(target - RPSStep)
+		}
+	case "u":
+		d.control.SetTargetRPS(0)
+	default:
+		return false
 	}
-	defer ui.Close()
 
-	const MaxWidth = 90
+	d.uiMutex.Lock()
+	d.controls.Text = d.controlsToString()
+	d.uiMutex.Unlock()
+	select {
+	case d.RefreshReqChan <- struct{}{}:
+	default:
+	}
 
-	const GaugeHeight = 3
-	const GraphHeight = 10
-	const TableHeight = 5
-	const LogsHeight = 12
+	return true
+}
 
-	d.launchRefreshWorker()
+func (d *Dashboard) handleLogKey(key string) bool {
+	d.uiMutex.Lock()
+	handled := d.errorLog.handleKey(key)
+	d.uiMutex.Unlock()
 
-	durationGaugePos := widgetPosition{
-		x1: 0,
-		y1: 0,
-		x2: MaxWidth,
-		y2: GaugeHeight,
+	if handled {
+		d.refreshUI()
 	}
+	return handled
+}
 
-	d.drawGauge("Test Duration", durationGaugePos)
-
-	resTimeGraphPos := widgetPosition{
-		x1: 0,
-		y1: GaugeHeight,
-		x2: MaxWidth / 3,
-		y2: GaugeHeight + GraphHeight,
+// resize lays the widgets out over the whole terminal and refits the graphs
+func (d *Dashboard) resize(width, height int) {
+	d.uiMutex.Lock()
+	d.grid.SetRect(0, 0, width, height)
+	for _, g := range d.graphs {
+		g.fit()
 	}
-	d.drawLineGraph("Responses times (ms)", resTimeGraphPos, uint64ToFloat64Chan(d.resTimes))
+	fitBars(d.distribution)
+	d.uiMutex.Unlock()
 
-	reqPSGraphPos := widgetPosition{
-		x1: MaxWidth / 3,
-		y1: GaugeHeight,
-		x2: 2 * (MaxWidth / 3),
-		y2: GaugeHeight + GraphHeight,
-	}
-	d.drawLineGraph("Requests per second", reqPSGraphPos, uint64ToFloat64Chan(d.reqPS))
+	d.refreshUI()
+}
 
-	resPSGraphPos := widgetPosition{
-		x1: 2 * (MaxWidth / 3),
-		y1: GaugeHeight,
-		x2: 3 * (MaxWidth / 3),
-		y2: GaugeHeight + GraphHeight,
+// DrawDashboard shows the dashboard until the test is stopped. It returns
+// an error if the terminal can't be taken over.
+func (d *Dashboard) DrawDashboard() error {
+	if err := ui.Init(); err != nil {
+		d.durationTicker.Stop()
+		return fmt.Errorf("could not initialize the terminal: %w", err)
 	}
-	d.drawLineGraph("Responses per second", resPSGraphPos, uint64ToFloat64Chan(d.resPS))
+	defer ui.Close()
 
-	resStatTablePos := widgetPosition{
-		x1: 0,
-		y1: GaugeHeight + GraphHeight,
-		x2: MaxWidth,
-		y2: GaugeHeight + GraphHeight + TableHeight,
-	}
-	d.drawTable("Response Stats", resStatTablePos)
+	// relative heights of the dashboard rows
+	const GaugeHeight = 3
+	const GraphHeight = 10
+	const DistributionHeight = 9
+	const TableHeight = 5
+	const LogsHeight = 12
+	const ControlsHeight = 4
+	const TotalHeight = GaugeHeight + GraphHeight + DistributionHeight + TableHeight + LogsHeight + ControlsHeight
 
-	errorLogsPos := widgetPosition{
-		x1: 0,
-		y1: GaugeHeight + GraphHeight + TableHeight,
-		x2: MaxWidth,
-		y2: GaugeHeight + GraphHeight + TableHeight + LogsHeight,
-	}
-	d.drawLogs("Error Logs", errorLogsPos)
+	d.launchRefreshWorker()
+
+	d.percentiles = d.newLineGraph("Response times p50/p90/p99 (ms)", ui.ColorYellow, ui.ColorCyan, ui.ColorRed)
+	d.reqPSGraph = d.newLineGraph("Requests per second", ui.ColorYellow)
+	d.resPSGraph = d.newLineGraph("Responses per second", ui.ColorYellow)
+	d.throughput = d.newLineGraph("KiB/s sent/received", ui.ColorYellow, ui.ColorCyan)
+
+	d.grid.Set(
+		ui.NewRow(GaugeHeight/float64(TotalHeight),
+			d.drawGauge("Test Duration"),
+		),
+		ui.NewRow(GraphHeight/float64(TotalHeight),
+			ui.NewCol(1.0/4, d.percentiles.plot),
+			ui.NewCol(1.0/4, d.reqPSGraph.plot),
+			ui.NewCol(1.0/4, d.resPSGraph.plot),
+			ui.NewCol(1.0/4, d.throughput.plot),
+		),
+		ui.NewRow(DistributionHeight/float64(TotalHeight),
+			ui.NewCol(2.0/3, d.drawDistribution("Response time distribution (ms)")),
+			ui.NewCol(1.0/3, d.drawBreakdown("Network errors")),
+		),
+		ui.NewRow(TableHeight/float64(TotalHeight),
+			d.drawTable("Response Stats"),
+		),
+		ui.NewRow(LogsHeight/float64(TotalHeight),
+			d.drawLogs("Error Logs"),
+		),
+		ui.NewRow(ControlsHeight/float64(TotalHeight),
+			d.drawControls("Controls"),
+		),
+	)
+
+	d.watchSnapshots()
+
+	termWidth, termHeight := ui.TerminalDimensions()
+	d.resize(termWidth, termHeight)
 
 	uiEvents := ui.PollEvents()
 	for {
-		e := <-uiEvents
-		switch e.ID {
-		case "q", "<C-c>":
-			d.cancel()
+		select {
+		case e := <-uiEvents:
+			// the error log gets first pick so typing a filter doesn't trigger controls
+			if e.ID != "<C-c>" && d.handleLogKey(e.ID) {
+				continue
+			}
+
+			switch e.ID {
+			case "q", "<C-c>":
+				d.cancel()
+				d.durationTicker.Stop()
+				return nil
+			case "<Resize>":
+				payload := e.Payload.(ui.Resize)
+				d.resize(payload.Width, payload.Height)
+			default:
+				d.handleControl(e.ID)
+			}
+		case <-d.stop:
 			d.durationTicker.Stop()
-			return
+			return nil
 		}
 	}
 }
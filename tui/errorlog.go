@@ -0,0 +1,406 @@
+package tui
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+	"github.com/startswithzed/blitz/core"
+)
+
+const maxErrorEntries = 1000
+
+// error type filters, cycled with the t key
+const (
+	showAllErrors = iota
+	showResponseErrors
+	showNetworkErrors
+	showTimeoutErrors
+	showDroppedErrors
+)
+
+var errorFilterNames = []string{"all", "response", "network", "timeout", "dropped"}
+
+// errorEntry groups identical errors so repeats show up as a count
+type errorEntry struct {
+	key    string
+	kind   int
+	count  uint64
+	first  time.Time
+	last   time.Time
+	sample interface{} // most recent occurrence
+	seen   uint64      // when the entry was last added to, in adds
+	row    int         // position in the visible rows, -1 if filtered out
+}
+
+// errorLog is a scrollable, filterable and deduplicated list of errors with
+// a detail view for the selected entry. Its methods must be called with the
+// ui mutex held.
+type errorLog struct {
+	ui.Block
+
+	title    string
+	list     *widgets.List
+	detail   *widgets.Paragraph
+	entries  []*errorEntry
+	index    map[string]*errorEntry
+	adds     uint64
+	visible  []*errorEntry
+	kind     int
+	filter   string
+	typing   bool
+	expanded bool
+}
+
+func newErrorLog(title string) *errorLog {
+	list := widgets.NewList()
+	list.SelectedRowStyle = ui.NewStyle(ui.ColorBlack, ui.ColorWhite)
+
+	detail := widgets.NewParagraph()
+	detail.Title = title + " - details"
+
+	l := &errorLog{
+		Block:  *ui.NewBlock(),
+		title:  title,
+		list:   list,
+		detail: detail,
+		index:  make(map[string]*errorEntry),
+	}
+	l.rebuild()
+
+	return l
+}
+
+func formatTimestamp(ts int64) string {
+	return time.Unix(0, ts).Format("15:04:05.000")
+}
+
+// formatCount writes a count with thousands separators, e.g. 1,204
+func formatCount(n uint64) string {
+	s := strconv.FormatUint(n, 10)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// errorKey groups errors that only differ in details that change on every
+// occurrence, such as the local port of a failed dial
+func errorKey(err interface{}) (string, int, bool) {
+	switch e := err.(type) {
+	case core.ResponseError:
+		return fmt.Sprintf("response|%t|%d|%s|%s|%s", e.Warmup, e.StatusCode, e.Status, e.Verb, e.URL), showResponseErrors, true
+	case core.NetworkError:
+		return fmt.Sprintf("network|%t|%d|%s|%s", e.Warmup, e.Category, e.Verb, e.URL), showNetworkErrors, true
+	case core.TimeoutError:
+		return fmt.Sprintf("timeout|%t|%s|%s|%v", e.Warmup, e.Verb, e.URL, e.Timeout), showTimeoutErrors, true
+	case core.DroppedConnectionError:
+		return fmt.Sprintf("dropped|%t|%s|%s", e.Warmup, e.Verb, e.URL), showDroppedErrors, true
+	default:
+		return "", 0, false
+	}
+}
+
+func errorTimestamp(err interface{}) int64 {
+	switch e := err.(type) {
+	case core.ResponseError:
+		return e.Timestamp
+	case core.NetworkError:
+		return e.Timestamp
+	case core.TimeoutError:
+		return e.Timestamp
+	case core.DroppedConnectionError:
+		return e.Timestamp
+	default:
+		return 0
+	}
+}
+
+// line renders an entry as a single styled log row
+func (e *errorEntry) line() string {
+	count := ""
+	if e.count > 1 {
+		count = fmt.Sprintf("  x %s", formatCount(e.count))
+	}
+
+	switch l := e.sample.(type) {
+	case core.ResponseError:
+		return fmt.Sprintf("%s%s  [%s](fg:red)  %s  [%s](fg:blue)%s", warmupTag(l.Warmup), formatTimestamp(l.Timestamp), statusLabel(l), l.Verb, l.URL, count)
+	case core.NetworkError:
+		return fmt.Sprintf("%s%s  [%s](fg:red)  %s  [%s](fg:blue)  %s%s", warmupTag(l.Warmup), formatTimestamp(l.Timestamp), l.Category, l.Verb, l.URL, l.Error, count)
+	case core.TimeoutError:
+		return fmt.Sprintf("%s%s  [timeout](fg:red)  %s  [%s](fg:blue)  no response within %v%s", warmupTag(l.Warmup), formatTimestamp(l.Timestamp), l.Verb, l.URL, l.Timeout, count)
+	case core.DroppedConnectionError:
+		return fmt.Sprintf("%s%s  [dropped](fg:red)  %s  [%s](fg:blue)  %s%s", warmupTag(l.Warmup), formatTimestamp(l.Timestamp), l.Verb, l.URL, l.Error, count)
+	default:
+		return ""
+	}
+}
+
+// statusLabel is the short status of a response error, e.g. 503
+func statusLabel(e core.ResponseError) string {
+	if e.Status != "" {
+		return e.Status
+	}
+	return strconv.Itoa(e.StatusCode)
+}
+
+// statusDetail spells the status of a response error out, e.g. 503 Service Unavailable
+func statusDetail(e core.ResponseError) string {
+	switch {
+	case e.Status != "" && e.StatusCode == 0:
+		return e.Status
+	case e.Status != "":
+		return fmt.Sprintf("%s (%d)", e.Status, e.StatusCode)
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+func requestDetail(req *core.Request) string {
+	if req == nil {
+		return ""
+	}
+
+	str := fmt.Sprintf("request:  %s %s\n", req.Verb, req.URL)
+
+	keys := make([]string, 0, len(req.Headers))
+	for k := range req.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		str += fmt.Sprintf("  %s: %s\n", k, req.Headers[k])
+	}
+
+	if req.Body != nil {
+		str += fmt.Sprintf("  %s\n", req.BodyBytes)
+	}
+
+	return str
+}
+
+// details renders the expanded view of an entry
+func (e *errorEntry) details() string {
+	str := fmt.Sprintf("count: %s  first seen: %s  last seen: %s\n\n",
+		formatCount(e.count), e.first.Format("15:04:05.000"), e.last.Format("15:04:05.000"))
+
+	switch l := e.sample.(type) {
+	case core.ResponseError:
+		str += requestDetail(l.Request)
+		str += fmt.Sprintf("\nresponse: [%s](fg:red)\n", statusDetail(l))
+		if l.Body != "" {
+			str += l.Body + "\n"
+		}
+	case core.NetworkError:
+		str += requestDetail(l.Request)
+		str += fmt.Sprintf("\nerror: [%s](fg:red)\n%s\n", l.Category, l.Error)
+	case core.TimeoutError:
+		str += requestDetail(l.Request)
+		str += fmt.Sprintf("\nerror: [timeout](fg:red)\nno response within %v\n", l.Timeout)
+	case core.DroppedConnectionError:
+		str += requestDetail(l.Request)
+		unit := "messages"
+		if l.Request != nil && l.Request.Stream != nil {
+			unit = "events"
+		}
+		str += fmt.Sprintf("\nerror: [dropped connection](fg:red) after %d %s\n%s\n", l.Messages, unit, l.Error)
+	}
+
+	return str + "\n[esc](fg:cyan) back"
+}
+
+func (l *errorLog) add(err interface{}) {
+	key, kind, ok := errorKey(err)
+	if !ok {
+		return
+	}
+
+	at := time.Unix(0, errorTimestamp(err))
+
+	e, found := l.index[key]
+	if !found {
+		if len(l.entries) >= maxErrorEntries {
+			l.evict()
+		}
+		e = &errorEntry{key: key, kind: kind, first: at, row: -1}
+		l.index[key] = e
+		l.entries = append(l.entries, e)
+	}
+
+	l.adds++
+	e.count++
+	e.last = at
+	e.sample = err
+	e.seen = l.adds
+
+	l.update(e)
+}
+
+// evict drops the entry that was added to least recently
+func (l *errorLog) evict() {
+	oldest := 0
+	for i, e := range l.entries {
+		if e.seen < l.entries[oldest].seen {
+			oldest = i
+		}
+	}
+
+	delete(l.index, l.entries[oldest].key)
+	l.entries = append(l.entries[:oldest], l.entries[oldest+1:]...)
+	l.rebuild()
+}
+
+// update refreshes the row of an entry that was just added to. Every row is
+// only rebuilt if the entry started or stopped matching the filters.
+func (l *errorLog) update(e *errorEntry) {
+	matches := l.matches(e)
+	switch {
+	case !matches && e.row < 0:
+		return
+	case matches && e.row >= 0:
+		l.list.Rows[e.row] = e.line()
+	case matches && l.entries[len(l.entries)-1] == e:
+		follow := !l.expanded && l.list.SelectedRow >= len(l.visible)-1
+		e.row = len(l.visible)
+		l.visible = append(l.visible, e)
+		l.list.Rows = append(l.list.Rows, e.line())
+		if follow {
+			l.list.SelectedRow = e.row
+		}
+		l.retitle()
+	default:
+		l.rebuild()
+		return
+	}
+
+	if l.expanded && l.list.SelectedRow == e.row {
+		l.detail.Text = e.details()
+	}
+}
+
+func (l *errorLog) matches(e *errorEntry) bool {
+	if l.kind != showAllErrors && e.kind != l.kind {
+		return false
+	}
+	return l.filter == "" || strings.Contains(strings.ToLower(e.line()), strings.ToLower(l.filter))
+}
+
+// rebuild refreshes the visible rows, following the newest entry if it was
+// selected and no entry is expanded
+func (l *errorLog) rebuild() {
+	follow := !l.expanded && l.list.SelectedRow >= len(l.visible)-1
+
+	l.visible = l.visible[:0]
+	rows := make([]string, 0, len(l.entries))
+	for _, e := range l.entries {
+		e.row = -1
+		if l.matches(e) {
+			e.row = len(l.visible)
+			l.visible = append(l.visible, e)
+			rows = append(rows, e.line())
+		}
+	}
+	l.list.Rows = rows
+
+	if follow || l.list.SelectedRow >= len(rows) {
+		l.list.SelectedRow = len(rows) - 1
+	}
+	if l.list.SelectedRow < 0 {
+		l.list.SelectedRow = 0
+	}
+	l.retitle()
+
+	if l.expanded && len(l.visible) > 0 {
+		l.detail.Text = l.visible[l.list.SelectedRow].details()
+	}
+}
+
+// retitle shows the number of visible entries and the filters in the title
+func (l *errorLog) retitle() {
+	filter := l.filter
+	if l.typing {
+		filter += "_"
+	}
+	l.list.Title = fmt.Sprintf("%s (%d) type: %s  filter: %s  |  ↑/↓ scroll  enter details  t type  / filter",
+		l.title, len(l.visible), errorFilterNames[l.kind], filter)
+}
+
+// handleKey applies a key press to the log and reports whether it was used.
+// While a filter is being typed every key goes to the filter.
+func (l *errorLog) handleKey(key string) bool {
+	if l.typing {
+		switch key {
+		case "<Enter>":
+			l.typing = false
+		case "<Escape>":
+			l.typing = false
+			l.filter = ""
+		case "<Backspace>", "<C-<Backspace>>":
+			if len(l.filter) > 0 {
+				runes := []rune(l.filter)
+				l.filter = string(runes[:len(runes)-1])
+			}
+		case "<Space>":
+			l.filter += " "
+		default:
+			if strings.HasPrefix(key, "<") && len(key) > 1 {
+				return true
+			}
+			l.filter += key
+		}
+		l.rebuild()
+		return true
+	}
+
+	if l.expanded {
+		switch key {
+		case "<Escape>", "<Enter>":
+			l.expanded = false
+			return true
+		}
+	}
+
+	switch key {
+	case "<Up>", "k":
+		l.list.ScrollUp()
+	case "<Down>", "j":
+		l.list.ScrollDown()
+	case "<PageUp>":
+		l.list.ScrollPageUp()
+	case "<PageDown>":
+		l.list.ScrollPageDown()
+	case "<Home>":
+		l.list.ScrollTop()
+	case "<End>":
+		l.list.ScrollBottom()
+	case "<Enter>":
+		l.expanded = len(l.visible) > 0
+	case "<Escape>":
+		l.filter = ""
+		l.kind = showAllErrors
+	case "t":
+		l.kind = (l.kind + 1) % len(errorFilterNames)
+	case "/":
+		l.typing = true
+	default:
+		return false
+	}
+
+	l.rebuild()
+	return true
+}
+
+func (l *errorLog) Draw(buf *ui.Buffer) {
+	var w ui.Drawable = l.list
+	if l.expanded {
+		w = l.detail
+	}
+
+	w.SetRect(l.Min.X, l.Min.Y, l.Max.X, l.Max.Y)
+	w.Draw(buf)
+}